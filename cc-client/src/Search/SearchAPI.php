@@ -146,13 +146,34 @@ class SearchAPI {
 				}
 				continue;
 			}
-			if ( $response->getStatusCode() != 200 ) {
+			// 207 means some documents in the chunk failed. Each item of the
+			// response reports its own status, so keep the ones that succeeded.
+			if ( $response->getStatusCode() != 200 && $response->getStatusCode() != 207 ) {
 				if ( $show_progress && class_exists('WP_CLI') ) {
 					\WP_CLI::warning("Failed to index document chunk: $current_chunk . Received response code: " . $response->getStatusCode());
 				}
 				continue;
 			}
-			$returned_documents = array_merge($returned_documents, SearchDocument::fromJSON($response->getBody()));
+			$results = json_decode($response->getBody(), true);
+			if ( ! is_array($results) ) {
+				if ( $show_progress && class_exists('WP_CLI') ) {
+					\WP_CLI::warning("Failed to index document chunk: $current_chunk . Invalid response body");
+				}
+				continue;
+			}
+			foreach ( $results as $result ) {
+				$status = $result['status'] ?? 0;
+				if ( $status < 200 || $status >= 300 ) {
+					if ( $show_progress && class_exists('WP_CLI') ) {
+						$error = $result['error'] ?? 'unknown error';
+						$index = $result['index'] ?? '?';
+						\WP_CLI::warning("Failed to index document $index of chunk $current_chunk : $error");
+					}
+					continue;
+				}
+				unset($result['index'], $result['status'], $result['error']);
+				$returned_documents[] = SearchDocument::fromJSON(json_encode($result));
+			}
 			if ( $show_progress && class_exists('WP_CLI') ) {
 				\WP_CLI::line('Indexed ' . count($returned_documents) . ' documents');
 			}
@@ -1,18 +1,53 @@
 package api
 
 import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+
 	"github.com/MESH-Research/commons-connect/cc-search/search"
 	"github.com/MESH-Research/commons-connect/cc-search/types"
 	"github.com/gin-gonic/gin"
 )
 
-func setupTestRouter() *gin.Engine {
-	conf := types.Config{
-		SearchEndpoint: "http://localhost:9200",
-		APIKey:         "12345",
-		IndexName:      "test",
-		ClientMode:     "noauth",
+// The API key of routers from setupTestRouter, unless conf sets another.
+const testAPIKey = "12345"
+
+// Returns a router over an empty in-memory backend, and the backend. The
+// index name and API key default to test values when conf leaves them empty.
+func setupTestRouter(conf types.Config) (*gin.Engine, *search.MemoryBackend) {
+	if conf.IndexName == "" {
+		conf.IndexName = "test"
+	}
+	if conf.APIKey == "" {
+		conf.APIKey = testAPIKey
 	}
-	searcher := search.GetSearcher(conf)
-	return SetupRouter(searcher, conf)
+	backend := search.NewMemoryBackend(conf.IndexName)
+	return SetupRouter(backend, conf), backend
+}
+
+// Sends a request to router and returns the response. A non-nil body is sent
+// as JSON, and headers are given as name, value pairs.
+func serveTestRequest(router http.Handler, method string, url string, body interface{}, headers ...string) *httptest.ResponseRecorder {
+	var reader io.Reader
+	if body != nil {
+		b, _ := json.Marshal(body)
+		reader = bytes.NewReader(b)
+	}
+	req, _ := http.NewRequest(method, url, reader)
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+// Decodes a search response, or returns an empty one.
+func decodeSearchResponse(w *httptest.ResponseRecorder) types.SearchResponse {
+	var response types.SearchResponse
+	json.NewDecoder(w.Body).Decode(&response)
+	return response
 }
@@ -1,50 +1,25 @@
 package api
 
 import (
-	"crypto/rand"
-	"fmt"
 	"log"
 	"net/http"
 	"strings"
 
-	"github.com/MESH-Research/commons-connect/cc-search/types"
+	"github.com/MESH-Research/commons-connect/cc-search/search"
 	"github.com/gin-gonic/gin"
 )
 
-// Helper function to generate a random token. This token is just
-// sent to stdout and not used anywhere. To be used by the api it
-// needs to be copied to the CC_SEARCH_API_TOKEN environment variable.
-func GenerateToken(tokenLength int) {
-	token := make([]byte, tokenLength)
-	_, err := rand.Read(token)
-	if err != nil {
-		panic(err)
-	}
-	fmt.Printf("%x", token)
-}
-
-func validateAPIToken(c *gin.Context) {
-	conf := c.MustGet("config").(types.Config)
-	if conf.APIKey == "" {
-		log.Println("Failed token validation: No token set in config or ENV")
-		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "No token set"})
-		return
+// Requires a valid API key with permission. An empty permission accepts any
+// valid key. The key is stored in the context as "apiKey".
+func requirePermission(permission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		keys := c.MustGet("keys").(*KeyRegistry)
+		validateToken(c, keys, permission)
 	}
-	validateToken(c, conf.APIKey)
 }
 
-func validateAdminAPIToken(c *gin.Context) {
-	conf := c.MustGet("config").(types.Config)
-	if conf.AdminAPIKey == "" {
-		log.Println("Failed token validation: No admin token set in config or ENV")
-		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "No admin token set"})
-		return
-	}
-	validateToken(c, conf.AdminAPIKey)
-}
-
-func validateToken(c *gin.Context, key string) {
-	if key == "" {
+func validateToken(c *gin.Context, keys *KeyRegistry, permission string) {
+	if keys.Empty() {
 		log.Println("Failed token validation: No token set in config or ENV")
 		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "No token set"})
 		return
@@ -56,15 +31,78 @@ func validateToken(c *gin.Context, key string) {
 		return
 	}
 	if len(strings.Split(token, " ")) != 2 {
-		log.Println("Failed token validation: Misformatted bearer token: ", token)
+		log.Println("Failed token validation: Misformatted bearer token")
 		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
 		return
 	}
 	token = strings.Split(token, " ")[1]
-	if token != key {
-		log.Println("Failed token validation: Invalid token: ", token)
+	key, ok := keys.Lookup(token)
+	if !ok {
+		log.Println("Failed token validation: Invalid or expired token with prefix ", tokenPrefix(token))
 		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
 		return
 	}
+	if !key.HasPermission(permission) {
+		log.Printf("Failed token validation: Key %s lacks %s permission", key.Name, permission)
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Forbidden"})
+		return
+	}
+	c.Set("apiKey", key)
 	c.Next()
 }
+
+// Returns the API key stored by requirePermission. Aborts with 401 and returns
+// false if there is none, so that a route wired without requirePermission
+// refuses writes rather than allowing them.
+func requestAPIKey(c *gin.Context) (APIKey, bool) {
+	value, ok := c.Get("apiKey")
+	if !ok {
+		log.Println("Failed authorization: No API key for request to ", c.FullPath())
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return APIKey{}, false
+	}
+	return value.(APIKey), true
+}
+
+// Aborts with 403 and returns false unless the request's API key may write
+// documents belonging to each of nodes.
+func authorizeNodes(c *gin.Context, nodes ...string) bool {
+	key, ok := requestAPIKey(c)
+	if !ok {
+		return false
+	}
+	for _, node := range nodes {
+		if !key.AllowsNode(node) {
+			log.Printf("Failed authorization: Key %s may not write to network node %q", key.Name, node)
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "API key may not write to network node " + node})
+			return false
+		}
+	}
+	return true
+}
+
+// Aborts with 403 and returns false unless the request's API key may write
+// the existing documents with ids. Documents that do not exist are skipped.
+// If the documents cannot be looked up, the request is refused.
+func authorizeExistingDocuments(c *gin.Context, backend search.Backend, ids ...string) bool {
+	key, ok := requestAPIKey(c)
+	if !ok {
+		return false
+	}
+	if key.AllowsNode(AllNetworkNodes) {
+		return true
+	}
+	nodes, err := backend.DocumentNetworkNodes(c.Request.Context(), ids)
+	if err != nil {
+		log.Println("Failed authorization: Error looking up documents: ", err)
+		c.AbortWithStatusJSON(errorStatus(c, err), gin.H{"error": err.Error()})
+		return false
+	}
+	for _, id := range ids {
+		node, ok := nodes[id]
+		if ok && !authorizeNodes(c, node) {
+			return false
+		}
+	}
+	return true
+}
@@ -1,24 +1,226 @@
 package api
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
-	"net/http"
-	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/MESH-Research/commons-connect/cc-search/config"
+	"github.com/MESH-Research/commons-connect/cc-search/search"
+	"github.com/MESH-Research/commons-connect/cc-search/types"
+	"github.com/gin-gonic/gin"
 	"github.com/go-playground/assert/v2"
 )
 
 func TestValidateToken(t *testing.T) {
 	conf := config.GetConfig()
-	router := setupTestRouter()
+	router, _ := setupTestRouter(types.Config{})
 
-	w := httptest.NewRecorder()
-	req, _ := http.NewRequest("GET", "/v1/ping", nil)
-	token := fmt.Sprintf("Bearer %s", conf.APIKey)
-	req.Header.Set("Authorization", token)
-	router.ServeHTTP(w, req)
+	w := serveTestRequest(router, "GET", "/v1/ping", nil, "Authorization", fmt.Sprintf("Bearer %s", conf.APIKey))
 
 	assert.Equal(t, 200, w.Code)
 }
+
+// Returns a router whose keys are read from a registry file, the backend
+// behind it, the registry file and the tokens of its keys by name.
+func setupScopedTestRouter(t *testing.T) (*gin.Engine, *search.MemoryBackend, string, map[string]string) {
+	keysFile := filepath.Join(t.TempDir(), "keys.json")
+	tokens := map[string]string{}
+	for name, scope := range map[string][2][]string{
+		"hc":     {{"hc"}, {PermissionWrite, PermissionDeleteNode}},
+		"reader": {{AllNetworkNodes}, {PermissionRead}},
+	} {
+		token, err := CreateKey(keysFile, name, scope[0], scope[1], nil)
+		if err != nil {
+			t.Fatalf("Error creating key: %v", err)
+		}
+		tokens[name] = token
+	}
+	conf := types.Config{
+		IndexName:   "test",
+		AdminAPIKey: "admin-key",
+		APIKeysFile: keysFile,
+	}
+	backend := search.NewMemoryBackend(conf.IndexName)
+	return SetupRouter(backend, conf), backend, keysFile, tokens
+}
+
+// Makes the registry file look modified, so that the next lookup reloads it
+// even if the filesystem's timestamps are coarse.
+func touchKeysFile(keysFile string) {
+	later := time.Now().Add(time.Minute)
+	os.Chtimes(keysFile, later, later)
+}
+
+// Sends a request authorized by key and returns the response status.
+func sendJSON(router *gin.Engine, method string, url string, key string, body interface{}) int {
+	return serveTestRequest(router, method, url, body, "Authorization", "Bearer "+key).Code
+}
+
+func TestScopedKeyWrites(t *testing.T) {
+	router, backend, _, tokens := setupScopedTestRouter(t)
+	ctx := context.Background()
+	mlaDocument, _ := backend.IndexDocument(ctx, types.Document{Title: "MLA", NetworkNode: "mla"})
+	hcDocument, _ := backend.IndexDocument(ctx, types.Document{Title: "HC", NetworkNode: "hc"})
+
+	assert.Equal(t, 200, sendJSON(router, "POST", "/v1/documents", tokens["hc"], types.Document{Title: "New", NetworkNode: "hc"}))
+	assert.Equal(t, 403, sendJSON(router, "POST", "/v1/documents", tokens["hc"], types.Document{Title: "New", NetworkNode: "mla"}))
+	assert.Equal(t, 403, sendJSON(router, "POST", "/v1/documents", tokens["hc"], types.Document{Title: "New"}))
+
+	// A key may neither change another node's document nor move its own
+	// documents to another node.
+	assert.Equal(t, 403, sendJSON(router, "PUT", "/v1/documents/"+mlaDocument.ID, tokens["hc"], types.Document{Title: "Taken", NetworkNode: "hc"}))
+	assert.Equal(t, 403, sendJSON(router, "PUT", "/v1/documents/"+hcDocument.ID, tokens["hc"], types.Document{Title: "Moved", NetworkNode: "mla"}))
+	assert.Equal(t, 200, sendJSON(router, "PUT", "/v1/documents/"+hcDocument.ID, tokens["hc"], types.Document{Title: "Renamed"}))
+	assert.Equal(t, 403, sendJSON(router, "DELETE", "/v1/documents/"+mlaDocument.ID, tokens["hc"], nil))
+
+	assert.Equal(t, 403, sendJSON(router, "PUT", "/v1/documents/by-internal-id/mla/1", tokens["hc"], types.Document{Title: "Upsert"}))
+	assert.Equal(t, 201, sendJSON(router, "PUT", "/v1/documents/by-internal-id/hc/1", tokens["hc"], types.Document{Title: "Upsert"}))
+
+	assert.Equal(t, 403, sendJSON(router, "POST", "/v1/documents/bulk", tokens["hc"], []types.Document{
+		{Title: "One", NetworkNode: "hc"},
+		{Title: "Two", NetworkNode: "mla"},
+	}))
+	assert.Equal(t, 403, sendJSON(router, "POST", "/v1/documents/bulk/upsert", tokens["hc"], []types.Document{
+		{Title: "One", NetworkNode: "mla", InternalID: "1"},
+	}))
+	assert.Equal(t, 403, sendJSON(router, "POST", "/v1/documents/bulk/update", tokens["hc"], []types.Document{
+		{ID: mlaDocument.ID, Title: "Taken"},
+	}))
+	assert.Equal(t, 403, sendJSON(router, "POST", "/v1/documents/bulk/delete", tokens["hc"], []string{hcDocument.ID, mlaDocument.ID}))
+
+	assert.Equal(t, 403, sendJSON(router, "DELETE", "/v1/documents?network_node=mla", tokens["hc"], nil))
+	assert.Equal(t, 200, sendJSON(router, "DELETE", "/v1/documents?network_node=hc", tokens["hc"], nil))
+
+	if _, err := backend.GetDocument(ctx, mlaDocument.ID); err != nil {
+		t.Errorf("Expected mla document to survive, got %v", err)
+	}
+}
+
+// failingLookupBackend is a backend whose documents cannot be looked up, as
+// when OpenSearch times out.
+type failingLookupBackend struct {
+	*search.MemoryBackend
+}
+
+func (backend failingLookupBackend) DocumentNetworkNodes(ctx context.Context, ids []string) (map[string]string, error) {
+	return nil, errors.New("connection reset by peer")
+}
+
+func TestScopedKeyLookupFailure(t *testing.T) {
+	_, backend, keysFile, tokens := setupScopedTestRouter(t)
+	router := SetupRouter(failingLookupBackend{backend}, types.Config{IndexName: "test", APIKeysFile: keysFile})
+	hcDocument, _ := backend.IndexDocument(context.Background(), types.Document{Title: "HC", NetworkNode: "hc"})
+
+	// Scoped writes to existing documents are refused when their network
+	// nodes cannot be checked, rather than let through.
+	assert.Equal(t, 500, sendJSON(router, "PUT", "/v1/documents/"+hcDocument.ID, tokens["hc"], types.Document{Title: "Renamed"}))
+	assert.Equal(t, 500, sendJSON(router, "DELETE", "/v1/documents/"+hcDocument.ID, tokens["hc"], nil))
+	assert.Equal(t, 500, sendJSON(router, "POST", "/v1/documents/bulk/delete", tokens["hc"], []string{hcDocument.ID}))
+	if _, err := backend.GetDocument(context.Background(), hcDocument.ID); err != nil {
+		t.Errorf("Expected document to survive, got %v", err)
+	}
+}
+
+func TestAuthorizeWithoutAPIKey(t *testing.T) {
+	router := gin.New()
+	backend := search.NewMemoryBackend("test")
+	// A route wired without requirePermission has no key to authorize.
+	router.POST("/nodes", func(c *gin.Context) {
+		if authorizeNodes(c, "hc") {
+			c.Status(200)
+		}
+	})
+	router.POST("/documents", func(c *gin.Context) {
+		if authorizeExistingDocuments(c, backend, "abc") {
+			c.Status(200)
+		}
+	})
+
+	assert.Equal(t, 401, serveTestRequest(router, "POST", "/nodes", nil).Code)
+	assert.Equal(t, 401, serveTestRequest(router, "POST", "/documents", nil).Code)
+}
+
+func TestScopedKeyPermissions(t *testing.T) {
+	router, _, _, tokens := setupScopedTestRouter(t)
+
+	assert.Equal(t, 401, sendJSON(router, "GET", "/v1/auth_check", "wrong-key", nil))
+	assert.Equal(t, 200, sendJSON(router, "GET", "/v1/auth_check", tokens["reader"], nil))
+	assert.Equal(t, 200, sendJSON(router, "GET", "/v1/index", tokens["reader"], nil))
+	assert.Equal(t, 403, sendJSON(router, "POST", "/v1/documents", tokens["reader"], types.Document{Title: "New", NetworkNode: "hc"}))
+	assert.Equal(t, 403, sendJSON(router, "GET", "/v1/admin_auth_check", tokens["hc"], nil))
+	assert.Equal(t, 200, sendJSON(router, "GET", "/v1/admin_auth_check", "admin-key", nil))
+	assert.Equal(t, 200, sendJSON(router, "DELETE", "/v1/documents?network_node=mla", "admin-key", nil))
+}
+
+func TestKeyRegistryReload(t *testing.T) {
+	router, _, keysFile, tokens := setupScopedTestRouter(t)
+
+	// Rotate the hc key: both keys work until the old one is revoked.
+	newToken, err := CreateKey(keysFile, "hc-2", []string{"hc"}, []string{PermissionWrite}, nil)
+	if err != nil {
+		t.Fatalf("Error creating key: %v", err)
+	}
+	touchKeysFile(keysFile)
+	assert.Equal(t, 200, sendJSON(router, "GET", "/v1/auth_check", newToken, nil))
+	assert.Equal(t, 200, sendJSON(router, "GET", "/v1/auth_check", tokens["hc"], nil))
+
+	err = RevokeKey(keysFile, "hc")
+	if err != nil {
+		t.Fatalf("Error revoking key: %v", err)
+	}
+	touchKeysFile(keysFile)
+	assert.Equal(t, 200, sendJSON(router, "GET", "/v1/auth_check", newToken, nil))
+	assert.Equal(t, 401, sendJSON(router, "GET", "/v1/auth_check", tokens["hc"], nil))
+}
+
+func TestKeyExpiry(t *testing.T) {
+	router, _, keysFile, _ := setupScopedTestRouter(t)
+	past := time.Now().Add(-time.Hour)
+	future := time.Now().Add(time.Hour)
+	expired, _ := CreateKey(keysFile, "expired", []string{"hc"}, []string{PermissionRead}, &past)
+	current, _ := CreateKey(keysFile, "current", []string{"hc"}, []string{PermissionRead}, &future)
+	touchKeysFile(keysFile)
+
+	assert.Equal(t, 401, sendJSON(router, "GET", "/v1/auth_check", expired, nil))
+	assert.Equal(t, 200, sendJSON(router, "GET", "/v1/auth_check", current, nil))
+}
+
+func TestKeyStorage(t *testing.T) {
+	keysFile := filepath.Join(t.TempDir(), "keys.json")
+	token, err := CreateKey(keysFile, "hc", []string{"hc"}, []string{PermissionWrite}, nil)
+	if err != nil {
+		t.Fatalf("Error creating key: %v", err)
+	}
+	data, _ := os.ReadFile(keysFile)
+	if bytes.Contains(data, []byte(token)) {
+		t.Error("Expected the token not to be stored in the keys file")
+	}
+	keys, err := LoadKeys(keysFile)
+	if err != nil || len(keys) != 1 {
+		t.Fatalf("Expected 1 key, got %v (%v)", keys, err)
+	}
+	if !keys[0].Matches(token) || keys[0].Matches(token[1:]) {
+		t.Error("Expected the key to match its token only")
+	}
+
+	if _, err := CreateKey(keysFile, "hc", []string{"hc"}, []string{PermissionWrite}, nil); err == nil {
+		t.Error("Expected error creating a duplicate key name, got nil")
+	}
+	if _, err := CreateKey(keysFile, "mla", []string{"mla"}, []string{"superuser"}, nil); err == nil {
+		t.Error("Expected error creating a key with an invalid permission, got nil")
+	}
+	if err := RevokeKey(keysFile, "missing"); err == nil {
+		t.Error("Expected error revoking a missing key, got nil")
+	}
+
+	os.WriteFile(keysFile, []byte(`{"keys": [{"name": "plain", "key": "plain-key"}]}`), 0600)
+	if _, err := LoadKeys(keysFile); err == nil {
+		t.Error("Expected error loading a key without a hash, got nil")
+	}
+}
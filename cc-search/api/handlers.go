@@ -1,9 +1,13 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
+	"slices"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -18,27 +22,47 @@ func handlePing(c *gin.Context) {
 }
 
 func handleGetIndex(c *gin.Context) {
-	searcher := c.MustGet("searcher").(types.Searcher)
-	info, err := search.GetIndexInfo(&searcher)
+	backend := c.MustGet("backend").(search.Backend)
+	info, err := backend.GetIndexInfo(c.Request.Context())
+	if err != nil {
+		c.JSON(errorStatus(c, err), gin.H{"error": err.Error()})
+		return
+	}
+	drift, err := search.IndexMappingDrift(info)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
+	for index, indexDrift := range drift {
+		if indexInfo, ok := info[index].(map[string]interface{}); ok {
+			indexInfo["mapping_drift"] = indexDrift
+		}
+	}
 	c.JSON(http.StatusOK, info)
 }
 
 func handleResetIndex(c *gin.Context) {
-	searcher := c.MustGet("searcher").(types.Searcher)
-	err := search.ResetIndex(&searcher)
+	backend := c.MustGet("backend").(search.Backend)
+	err := backend.ResetIndex(c.Request.Context())
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(errorStatus(c, err), gin.H{"error": err.Error()})
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"message": "Index reset"})
 }
 
+func handleReindex(c *gin.Context) {
+	backend := c.MustGet("backend").(search.Backend)
+	result, err := backend.Reindex(c.Request.Context())
+	if err != nil {
+		c.JSON(errorStatus(c, err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, result)
+}
+
 func handleNewDocument(c *gin.Context) {
-	searcher := c.MustGet("searcher").(types.Searcher)
+	backend := c.MustGet("backend").(search.Backend)
 	body := c.Request.Body
 	var newDocument types.Document
 	err := json.NewDecoder(body).Decode(&newDocument)
@@ -50,12 +74,15 @@ func handleNewDocument(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "ID should not be provided for new documents"})
 		return
 	}
-	indexedDocument, err := search.IndexDocument(
-		searcher,
+	if !authorizeNodes(c, newDocument.NetworkNode) {
+		return
+	}
+	indexedDocument, err := backend.IndexDocument(
+		c.Request.Context(),
 		newDocument,
 	)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(errorStatus(c, err), gin.H{"error": err.Error()})
 		return
 	}
 	log.Println("Received document ID: ", indexedDocument.ID)
@@ -63,8 +90,49 @@ func handleNewDocument(c *gin.Context) {
 	c.JSON(http.StatusOK, indexedDocument)
 }
 
+func handleUpsertDocument(c *gin.Context) {
+	backend := c.MustGet("backend").(search.Backend)
+	networkNode := c.Param("network_node")
+	internalID := c.Param("internal_id")
+	body := c.Request.Body
+	var document types.Document
+	err := json.NewDecoder(body).Decode(&document)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if document.ID != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID should not be provided for upserted documents"})
+		return
+	}
+	if document.NetworkNode != "" && document.NetworkNode != networkNode {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Document network_node does not match URL"})
+		return
+	}
+	if document.InternalID != "" && document.InternalID != internalID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Document _internal_id does not match URL"})
+		return
+	}
+	if !authorizeNodes(c, networkNode) {
+		return
+	}
+	document.NetworkNode = networkNode
+	document.InternalID = internalID
+	indexedDocument, created, err := backend.UpsertDocument(c.Request.Context(), document)
+	if err != nil {
+		c.JSON(errorStatus(c, err), gin.H{"error": err.Error()})
+		return
+	}
+	indexedDocument.FilterOut([]string{"Content"})
+	if created {
+		c.JSON(http.StatusCreated, indexedDocument)
+		return
+	}
+	c.JSON(http.StatusOK, indexedDocument)
+}
+
 func handleBulkNewDocuments(c *gin.Context) {
-	searcher := c.MustGet("searcher").(types.Searcher)
+	backend := c.MustGet("backend").(search.Backend)
 	body := c.Request.Body
 	var newDocuments []types.Document
 	err := json.NewDecoder(body).Decode(&newDocuments)
@@ -72,28 +140,150 @@ func handleBulkNewDocuments(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	nodes := []string{}
 	for _, document := range newDocuments {
 		if document.ID != "" {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "ID should not be provided for new documents"})
 			return
 		}
+		nodes = append(nodes, document.NetworkNode)
+	}
+	if !authorizeNodes(c, nodes...) {
+		return
 	}
-	indexedDocuments, err := search.BulkIndexDocuments(
-		searcher,
+	results, err := backend.BulkIndexDocuments(
+		c.Request.Context(),
 		newDocuments,
 	)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(errorStatus(c, err), gin.H{"error": err.Error()})
+		return
+	}
+	for i := range results {
+		results[i].FilterOut([]string{"Content"})
+	}
+	c.JSON(bulkResultsStatus(results), results)
+}
+
+func handleBulkUpdateDocuments(c *gin.Context) {
+	backend := c.MustGet("backend").(search.Backend)
+	body := c.Request.Body
+	var updatedDocuments []types.Document
+	err := json.NewDecoder(body).Decode(&updatedDocuments)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	ids := []string{}
+	nodes := []string{}
+	for _, document := range updatedDocuments {
+		if document.ID == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "ID is required for each updated document"})
+			return
+		}
+		ids = append(ids, document.ID)
+		if document.NetworkNode != "" {
+			nodes = append(nodes, document.NetworkNode)
+		}
+	}
+	if !authorizeNodes(c, nodes...) || !authorizeExistingDocuments(c, backend, ids...) {
+		return
+	}
+	results, err := backend.BulkUpdateDocuments(c.Request.Context(), updatedDocuments)
+	if err != nil {
+		c.JSON(errorStatus(c, err), gin.H{"error": err.Error()})
+		return
+	}
+	for i := range results {
+		results[i].FilterOut([]string{"Content"})
+	}
+	c.JSON(bulkResultsStatus(results), results)
+}
+
+func handleBulkUpsertDocuments(c *gin.Context) {
+	backend := c.MustGet("backend").(search.Backend)
+	body := c.Request.Body
+	var documents []types.Document
+	err := json.NewDecoder(body).Decode(&documents)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	for _, document := range documents {
+		if document.ID != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "ID should not be provided for upserted documents"})
+			return
+		}
+		if document.NetworkNode == "" || document.InternalID == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "network_node and _internal_id are required for each upserted document"})
+			return
+		}
+		if !authorizeNodes(c, document.NetworkNode) {
+			return
+		}
+	}
+	results, err := backend.BulkUpsertDocuments(c.Request.Context(), documents)
+	if err != nil {
+		c.JSON(errorStatus(c, err), gin.H{"error": err.Error()})
 		return
 	}
-	for i := range indexedDocuments {
-		indexedDocuments[i].FilterOut([]string{"Content"})
+	for i := range results {
+		results[i].FilterOut([]string{"Content"})
 	}
-	c.JSON(http.StatusOK, indexedDocuments)
+	c.JSON(bulkResultsStatus(results), results)
+}
+
+func handleBulkDeleteDocuments(c *gin.Context) {
+	backend := c.MustGet("backend").(search.Backend)
+	body := c.Request.Body
+	var ids []string
+	err := json.NewDecoder(body).Decode(&ids)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	for _, id := range ids {
+		if id == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "IDs must not be empty"})
+			return
+		}
+	}
+	if !authorizeExistingDocuments(c, backend, ids...) {
+		return
+	}
+	results, err := backend.BulkDeleteDocuments(c.Request.Context(), ids)
+	if err != nil {
+		c.JSON(errorStatus(c, err), gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(bulkResultsStatus(results), results)
+}
+
+// errorStatus returns the status for an error from a request to OpenSearch:
+// 504 if the request's deadline expired first, 404 if a document it needed
+// does not exist, otherwise 500.
+func errorStatus(c *gin.Context, err error) int {
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(c.Request.Context().Err(), context.DeadlineExceeded) {
+		return http.StatusGatewayTimeout
+	}
+	if errors.Is(err, search.ErrDocumentNotFound) {
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
+
+// Returns 200 if every item in a bulk request succeeded, or 207 if any failed.
+func bulkResultsStatus(results []types.BulkItemResult) int {
+	for _, result := range results {
+		if !result.Succeeded() {
+			return http.StatusMultiStatus
+		}
+	}
+	return http.StatusOK
 }
 
 func handleUpdateDocument(c *gin.Context) {
-	searcher := c.MustGet("searcher").(types.Searcher)
+	backend := c.MustGet("backend").(search.Backend)
 	body := c.Request.Body
 	id := c.Param("id")
 	var updatedDocument types.Document
@@ -102,10 +292,16 @@ func handleUpdateDocument(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if updatedDocument.NetworkNode != "" && !authorizeNodes(c, updatedDocument.NetworkNode) {
+		return
+	}
+	if !authorizeExistingDocuments(c, backend, id) {
+		return
+	}
 	updatedDocument.ID = id
-	err = search.UpdateDocument(searcher, updatedDocument)
+	err = backend.UpdateDocument(c.Request.Context(), updatedDocument)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(errorStatus(c, err), gin.H{"error": err.Error()})
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"message": "Document updated"})
@@ -117,10 +313,16 @@ func handleGetDocument(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "ID is required"})
 		return
 	}
-	searcher := c.MustGet("searcher").(types.Searcher)
-	document, err := search.GetDocument(searcher, id)
+	backend := c.MustGet("backend").(search.Backend)
+	document, err := backend.GetDocument(c.Request.Context(), id)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(errorStatus(c, err), gin.H{"error": err.Error()})
+		return
+	}
+	// Documents the viewer may not see are reported as missing, so that
+	// their existence is not revealed.
+	if !c.MustGet("viewer").(*types.Viewer).CanView(*document) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Document not found"})
 		return
 	}
 	fieldsQuery := c.Query("fields")
@@ -128,6 +330,7 @@ func handleGetDocument(c *gin.Context) {
 	if len(fields) > 0 && fields[0] != "" {
 		document.FilterByJSON(fields)
 	}
+	document.HideAccessControl()
 	c.JSON(http.StatusOK, document)
 }
 
@@ -137,10 +340,13 @@ func handleDeleteDocument(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "ID is required"})
 		return
 	}
-	searcher := c.MustGet("searcher").(types.Searcher)
-	err := search.DeleteDocument(searcher, id)
+	backend := c.MustGet("backend").(search.Backend)
+	if !authorizeExistingDocuments(c, backend, id) {
+		return
+	}
+	err := backend.DeleteDocument(c.Request.Context(), id)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(errorStatus(c, err), gin.H{"error": err.Error()})
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"message": "Document deleted"})
@@ -152,37 +358,114 @@ func handleDeleteNode(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Network node is required"})
 		return
 	}
-	searcher := c.MustGet("searcher").(types.Searcher)
-	err := search.DeleteNode(searcher, node)
+	if !authorizeNodes(c, node) {
+		return
+	}
+	backend := c.MustGet("backend").(search.Backend)
+	err := backend.DeleteNode(c.Request.Context(), node)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(errorStatus(c, err), gin.H{"error": err.Error()})
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"message": "Node deleted"})
 }
 
+// Parameters of GET /search other than filters.
+var searchParameters = []string{
+	"q", "fields", "search_fields", "facets", "highlight", "highlight_fields",
+	"fragment_size", "start_date", "end_date", "date_field", "sort", "sort_dir",
+	"sort_by", "page", "per_page", "cursor", "pit", "suggest", "rank",
+}
+
+// searchParameterNames returns the parameters and filter fields accepted by
+// GET /search, sorted. Filters may also be prefixed with not_ or -.
+func searchParameterNames() []string {
+	names := append(slices.Clone(searchParameters), "username")
+	names = append(names, search.FilterFields()...)
+	sort.Strings(names)
+	return names
+}
+
 func handleSearch(c *gin.Context) {
-	searcher := c.MustGet("searcher").(types.Searcher)
+	backend := c.MustGet("backend").(search.Backend)
 	params := types.SearchParams{
-		ExactMatch: make(map[string]string),
+		ExactMatch:   make(map[string][]string),
+		ExcludeMatch: make(map[string][]string),
+		Viewer:       c.MustGet("viewer").(*types.Viewer),
 	}
+	rank := ""
 	queryVals := c.Request.URL.Query()
 	for key, val := range queryVals {
 		switch key {
 		case "q":
 			params.Query = val[0]
 		case "fields":
-			params.ReturnFields = strings.Split(val[0], ",")
+			returnFields, err := search.ParseReturnFields(val[0])
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			params.ReturnFields = returnFields
 		case "search_fields":
-			params.SearchFields = strings.Split(val[0], ",")
-		case "start_date":
-			params.StartDate = val[0]
-		case "end_date":
-			params.EndDate = val[0]
-		case "sort_dir":
-			params.SortDirection = val[0]
-		case "sort_by":
-			params.SortField = val[0]
+			searchFields, err := search.ParseSearchFields(val[0])
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			params.SearchFields = searchFields
+		case "facets":
+			facets, err := search.ParseFacets(val[0])
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			params.Facets = facets
+		case "highlight":
+			highlight, err := strconv.ParseBool(val[0])
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid highlight value"})
+				return
+			}
+			params.Highlight = highlight
+		case "highlight_fields":
+			highlightFields, err := search.ParseHighlightFields(val[0])
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			params.HighlightFields = highlightFields
+		case "fragment_size":
+			fragmentSize, err := strconv.Atoi(val[0])
+			if err != nil || fragmentSize < 1 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid fragment_size value"})
+				return
+			}
+			params.FragmentSize = fragmentSize
+		case "start_date", "end_date":
+			if err := search.ValidateDate(val[0]); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + key + ": " + err.Error()})
+				return
+			}
+			if key == "start_date" {
+				params.StartDate = val[0]
+			} else {
+				params.EndDate = val[0]
+			}
+		case "date_field":
+			if err := search.ValidateDateField(val[0]); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			params.DateField = val[0]
+		case "sort":
+			sortKeys, err := search.ParseSort(val[0])
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			params.Sort = sortKeys
+		case "sort_by", "sort_dir":
+			// sort_by and sort_dir are the single-field form of sort.
 		case "page":
 			page, err := strconv.Atoi(val[0])
 			if err != nil {
@@ -197,32 +480,218 @@ func handleSearch(c *gin.Context) {
 				return
 			}
 			params.PerPage = perPage
-		case "username":
-			params.ExactMatch["contributors.username"] = val[0]
+		case "cursor":
+			params.Cursor = val[0]
+		case "pit":
+			pit, err := strconv.ParseBool(val[0])
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid pit value"})
+				return
+			}
+			params.PointInTime = pit
+		case "suggest":
+			suggest, err := strconv.ParseBool(val[0])
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid suggest value"})
+				return
+			}
+			params.Suggest = suggest
+		case "rank":
+			if val[0] != search.RankRelevance && val[0] != search.RankRecent {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid rank value"})
+				return
+			}
+			rank = val[0]
 		default:
-			params.ExactMatch[key] = val[0]
+			field, exclude := exactMatchField(key)
+			if !slices.Contains(search.FilterFields(), field) {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"error":            "Invalid parameter: " + key,
+					"valid_parameters": searchParameterNames(),
+				})
+				return
+			}
+			addExactMatch(&params, field, exclude, val)
 		}
 	}
-	result, err := search.Search(searcher, params)
+	if sortBy := queryVals.Get("sort_by"); sortBy != "" {
+		if params.Sort != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "sort_by cannot be combined with sort"})
+			return
+		}
+		sortKey, err := search.NewSortKey(sortBy, queryVals.Get("sort_dir"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		params.Sort = []types.SortKey{sortKey}
+	}
+	if params.Cursor != "" && params.Page > 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "page cannot be combined with cursor"})
+		return
+	}
+	conf := c.MustGet("config").(types.Config)
+	params.SuggestThreshold = suggestThreshold(conf)
+	// The ranking configuration is validated by SetupRouter and rank above.
+	params.Recency, _ = search.RecencyBoost(conf, rank)
+	if len(params.SearchFields) == 0 {
+		searchFields, err := search.ConfiguredSearchFields(conf)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		params.SearchFields = searchFields
+	}
+	result, err := backend.Search(c.Request.Context(), params)
+	if errors.Is(err, search.ErrInvalidCursor) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	var syntaxError *search.QuerySyntaxError
+	if errors.As(err, &syntaxError) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":    "Invalid query",
+			"reason":   syntaxError.Reason,
+			"position": syntaxError.Position,
+		})
+		return
+	}
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(errorStatus(c, err), gin.H{"error": err.Error()})
 		return
 	}
+	hideAccessControl(result.Hits)
 	c.JSON(http.StatusOK, result)
 }
 
+// Clears the access control fields of search hits before they are returned.
+func hideAccessControl(hits []types.SearchHit) {
+	for i := range hits {
+		hits[i].HideAccessControl()
+	}
+}
+
+// Returns the configured suggest threshold. Unset uses the default, and a
+// negative threshold only returns suggestions when requested.
+func suggestThreshold(conf types.Config) int {
+	switch {
+	case conf.SuggestThreshold < 0:
+		return 0
+	case conf.SuggestThreshold == 0:
+		return search.DefaultSuggestThreshold
+	}
+	return conf.SuggestThreshold
+}
+
 func handleTypeAheadSearch(c *gin.Context) {
-	searcher := c.MustGet("searcher").(types.Searcher)
+	backend := c.MustGet("backend").(search.Backend)
 	query := c.Query("q")
 	if query == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Query is required"})
 		return
 	}
-	result, err := search.TypeAheadSearch(searcher, query)
+	result, err := backend.TypeAheadSearch(c.Request.Context(), query, c.MustGet("viewer").(*types.Viewer))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(errorStatus(c, err), gin.H{"error": err.Error()})
+		return
+	}
+	for i := range result {
+		result[i].HideAccessControl()
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+// exactMatchField returns the field filtered by a search parameter, and
+// whether the filter excludes its values rather than requiring one of them.
+// Parameters prefixed with not_ or - are exclusions, and username is short for
+// contributors.username.
+func exactMatchField(key string) (string, bool) {
+	field, exclude := strings.CutPrefix(key, "not_")
+	if !exclude {
+		field, exclude = strings.CutPrefix(key, "-")
+	}
+	if field == "username" {
+		field = "contributors.username"
+	}
+	return field, exclude
+}
+
+// addExactMatch adds the values of a filter parameter for field to params.
+// Repeated parameters and comma-separated values match any of the values.
+func addExactMatch(params *types.SearchParams, field string, exclude bool, values []string) {
+	matches := params.ExactMatch
+	if exclude {
+		matches = params.ExcludeMatch
+	}
+	for _, value := range values {
+		for _, item := range strings.Split(value, ",") {
+			item = strings.TrimSpace(item)
+			if item != "" {
+				matches[field] = append(matches[field], item)
+			}
+		}
+	}
+}
+
+func handleRelatedDocuments(c *gin.Context) {
+	id := c.Param("id")
+	if id == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ID is required"})
+		return
+	}
+	backend := c.MustGet("backend").(search.Backend)
+	viewer := c.MustGet("viewer").(*types.Viewer)
+	params := types.SearchParams{
+		ExactMatch:   make(map[string][]string),
+		ExcludeMatch: make(map[string][]string),
+		Viewer:       viewer,
+	}
+	for key, val := range c.Request.URL.Query() {
+		field, exclude := exactMatchField(key)
+		switch {
+		case key == "fields":
+			returnFields, err := search.ParseReturnFields(val[0])
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			params.ReturnFields = returnFields
+		case key == "per_page":
+			perPage, err := strconv.Atoi(val[0])
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid per_page value"})
+				return
+			}
+			params.PerPage = perPage
+		case slices.Contains(search.RelatedFilterFields, field):
+			addExactMatch(&params, field, exclude, val)
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":            "Invalid parameter: " + key,
+				"valid_parameters": append([]string{"fields", "per_page"}, search.RelatedFilterFields...),
+			})
+			return
+		}
+	}
+
+	// As for GET /documents/{id}, a source document the viewer may not see is
+	// reported as missing.
+	document, err := backend.GetDocument(c.Request.Context(), id)
+	if err != nil {
+		c.JSON(errorStatus(c, err), gin.H{"error": err.Error()})
+		return
+	}
+	if !viewer.CanView(*document) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Document not found"})
+		return
+	}
+
+	result, err := backend.RelatedDocuments(c.Request.Context(), id, params)
+	if err != nil {
+		c.JSON(errorStatus(c, err), gin.H{"error": err.Error()})
 		return
 	}
+	hideAccessControl(result.Hits)
 	c.JSON(http.StatusOK, result)
 }
 
@@ -1,34 +1,273 @@
 package api
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"slices"
 	"testing"
+	"time"
 
+	"github.com/MESH-Research/commons-connect/cc-search/search"
 	"github.com/MESH-Research/commons-connect/cc-search/types"
 	"github.com/go-playground/assert/v2"
 )
 
 func TestHandleNewDocument(t *testing.T) {
-	router := setupTestRouter()
+	router, _ := setupTestRouter(types.Config{})
 
 	newDocument := types.Document{
 		Title:       "Test Document",
 		PrimaryURL:  "https://example.com",
 		Description: "This is a test document",
 	}
+	w := serveTestRequest(router, "POST", "/v1/documents", newDocument, "Authorization", "Bearer "+testAPIKey)
 
-	w := httptest.NewRecorder()
-	b, err := json.Marshal(newDocument)
-	if err != nil {
-		t.Fatalf("Error encoding document: %v", err)
+	assert.Equal(t, 200, w.Code)
+}
+
+func TestHandleUpsertDocumentMismatch(t *testing.T) {
+	router, _ := setupTestRouter(types.Config{})
+
+	document := types.Document{
+		Title:       "Test Document",
+		NetworkNode: "mla",
+	}
+	w := serveTestRequest(router, "PUT", "/v1/documents/by-internal-id/hc/post%2F123", document, "Authorization", "Bearer "+testAPIKey)
+
+	assert.Equal(t, 400, w.Code)
+}
+
+func TestBulkResultsStatus(t *testing.T) {
+	results := []types.BulkItemResult{
+		{Index: 0, Status: 201},
+		{Index: 1, Status: 201},
+	}
+	assert.Equal(t, 200, bulkResultsStatus(results))
+	results = append(results, types.BulkItemResult{Index: 2, Status: 400, Error: "mapper_parsing_exception"})
+	assert.Equal(t, 207, bulkResultsStatus(results))
+}
+
+func TestHandleSearchTimeout(t *testing.T) {
+	// Stands in for a cluster that does not answer until the test ends.
+	release := make(chan struct{})
+	stub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer stub.Close()
+	defer close(release)
+
+	conf := types.Config{
+		SearchEndpoint: stub.URL,
+		IndexName:      "test",
+		ClientMode:     "noauth",
+		SearchTimeout:  50 * time.Millisecond,
+	}
+	router := SetupRouter(search.GetBackend(conf), conf)
+
+	assert.Equal(t, 504, serveTestRequest(router, "GET", "/v1/search?q=test", nil).Code)
+}
+
+func TestHandleRelatedDocuments(t *testing.T) {
+	router, backend := setupTestRouter(types.Config{})
+	ctx := context.Background()
+	source, _ := backend.IndexDocument(ctx, types.Document{Title: "Medieval manuscripts", Content: "Illuminated manuscripts of the medieval period", ContentType: "article"})
+	backend.IndexDocument(ctx, types.Document{Title: "Manuscripts in archives", ContentType: "article"})
+	backend.IndexDocument(ctx, types.Document{Title: "Medieval music", ContentType: "book"})
+	backend.IndexDocument(ctx, types.Document{Title: "Open access publishing", ContentType: "article"})
+	backend.IndexDocument(ctx, types.Document{Title: "Private manuscripts", Visibility: types.VisibilityPrivate})
+
+	related := func(query string) (int, types.SearchResponse) {
+		w := serveTestRequest(router, "GET", "/v1/documents/"+source.ID+"/related"+query, nil)
+		return w.Code, decodeSearchResponse(w)
+	}
+
+	code, response := related("")
+	assert.Equal(t, 200, code)
+	assert.Equal(t, int64(2), response.Total)
+	for _, hit := range response.Hits {
+		if hit.ID == source.ID {
+			t.Errorf("Expected source document to be excluded, got %v", hit)
+		}
+	}
+
+	code, response = related("?content_type=article&fields=title")
+	assert.Equal(t, 200, code)
+	assert.Equal(t, 1, len(response.Hits))
+	assert.Equal(t, "Manuscripts in archives", response.Hits[0].Title)
+	assert.Equal(t, "", response.Hits[0].ContentType)
+
+	code, _ = related("?language=en")
+	assert.Equal(t, 400, code)
+
+	assert.Equal(t, 404, serveTestRequest(router, "GET", "/v1/documents/missing/related", nil).Code)
+	assert.Equal(t, 404, serveTestRequest(router, "GET", "/v1/documents/missing", nil).Code)
+}
+
+func TestHandleSearchSuggestions(t *testing.T) {
+	router, backend := setupTestRouter(types.Config{SuggestThreshold: -1})
+	backend.IndexDocument(context.Background(), types.Document{Title: "Medieval manuscripts"})
+
+	suggestions := func(query string) []string {
+		w := serveTestRequest(router, "GET", "/v1/search?"+query, nil)
+		assert.Equal(t, 200, w.Code)
+		return decodeSearchResponse(w).Suggestions
+	}
+	assert.Equal(t, 0, len(suggestions("q=medeival")))
+	assert.Equal(t, []string{"medieval"}, suggestions("q=medeival&suggest=true"))
+}
+
+func TestHandleSearchQuerySyntax(t *testing.T) {
+	router, _ := setupTestRouter(types.Config{})
+
+	w := serveTestRequest(router, "GET", "/v1/search?q="+url.QueryEscape(`title:"open`), nil)
+	assert.Equal(t, 400, w.Code)
+	var response struct {
+		Error    string `json:"error"`
+		Reason   string `json:"reason"`
+		Position int    `json:"position"`
 	}
-	body := bytes.NewReader(b)
-	req, _ := http.NewRequest("POST", "/v1/documents", body)
-	req.Header.Set("Authorization", "Bearer 12345")
-	router.ServeHTTP(w, req)
+	json.NewDecoder(w.Body).Decode(&response)
+	assert.Equal(t, "Invalid query", response.Error)
+	assert.Equal(t, "unterminated quoted phrase", response.Reason)
+	assert.Equal(t, 6, response.Position)
 
+	w = serveTestRequest(router, "GET", "/v1/search?q="+url.QueryEscape(`"open access" -draft`), nil)
 	assert.Equal(t, 200, w.Code)
 }
+
+func TestHandleSearchExactMatch(t *testing.T) {
+	router, backend := setupTestRouter(types.Config{})
+	backend.BulkIndexDocuments(context.Background(), []types.Document{
+		{Title: "Open Post", ContentType: "post", NetworkNode: "hc"},
+		{Title: "Open Group", ContentType: "group", NetworkNode: "mla"},
+		{Title: "Open Book", ContentType: "book", NetworkNode: "hc", Contributors: []types.User{{Username: "jdoe"}}},
+	})
+
+	total := func(query string) int64 {
+		w := serveTestRequest(router, "GET", "/v1/search?q=open&"+query, nil)
+		assert.Equal(t, 200, w.Code)
+		return decodeSearchResponse(w).Total
+	}
+	assert.Equal(t, int64(1), total("content_type=post"))
+	assert.Equal(t, int64(2), total("content_type=post&content_type=group"))
+	assert.Equal(t, int64(2), total("content_type=post,group"))
+	assert.Equal(t, int64(1), total("content_type=post,group&network_node=mla"))
+	assert.Equal(t, int64(2), total("not_content_type=group"))
+	assert.Equal(t, int64(1), total("-content_type=group,book"))
+	assert.Equal(t, int64(2), total("-username=jdoe"))
+}
+
+func TestHandleSearchInvalidParameters(t *testing.T) {
+	router, _ := setupTestRouter(types.Config{})
+
+	get := func(query string) *httptest.ResponseRecorder {
+		return serveTestRequest(router, "GET", "/v1/search?"+query, nil)
+	}
+	w := get("q=open&contnet_type=post")
+	assert.Equal(t, 400, w.Code)
+	var response struct {
+		Error           string   `json:"error"`
+		ValidParameters []string `json:"valid_parameters"`
+	}
+	json.NewDecoder(w.Body).Decode(&response)
+	assert.Equal(t, "Invalid parameter: contnet_type", response.Error)
+	assert.Equal(t, true, slices.Contains(response.ValidParameters, "content_type"))
+	assert.Equal(t, true, slices.Contains(response.ValidParameters, "q"))
+
+	assert.Equal(t, 400, get("visibility=private").Code)
+	assert.Equal(t, 400, get("not_primary_url=x").Code)
+
+	// Text fields are analyzed, so they are searched with q rather than
+	// filtered on.
+	w = get("title=Open+Access")
+	assert.Equal(t, 400, w.Code)
+	json.NewDecoder(w.Body).Decode(&response)
+	assert.Equal(t, "Invalid parameter: title", response.Error)
+	assert.Equal(t, true, slices.Contains(response.ValidParameters, "title.keyword"))
+	assert.Equal(t, 400, get("-description=draft").Code)
+	assert.Equal(t, 200, get("title.keyword=Open+Access").Code)
+	assert.Equal(t, 400, get("sort_by=title").Code)
+	assert.Equal(t, 400, get("fields=title,secret").Code)
+	assert.Equal(t, 200, get("q=open&content_type=post&-network_node=mla&username=jdoe&sort_by=publication_date&fields=title,owner").Code)
+}
+
+func TestHandleSearchDateRange(t *testing.T) {
+	router, backend := setupTestRouter(types.Config{})
+	backend.BulkIndexDocuments(context.Background(), []types.Document{
+		{Title: "Changed", ModifiedDate: time.Now().UTC().Format(time.RFC3339)},
+		{Title: "Unchanged", ModifiedDate: "2020-01-01"},
+	})
+
+	get := func(query string) *httptest.ResponseRecorder {
+		return serveTestRequest(router, "GET", "/v1/search?"+query, nil)
+	}
+	w := get("date_field=modified_date&start_date=now-1d")
+	assert.Equal(t, 200, w.Code)
+	assert.Equal(t, int64(1), decodeSearchResponse(w).Total)
+
+	assert.Equal(t, 200, get("date_field=modified_date&start_date="+url.QueryEscape("2020-01-01T00:00:00+00:00")).Code)
+	assert.Equal(t, 400, get("start_date=yesterday").Code)
+	assert.Equal(t, 400, get("end_date=2020-01-01T00:00:00+00:00").Code)
+	assert.Equal(t, 400, get("date_field=title&start_date=2020").Code)
+}
+
+func TestHandleSearchRank(t *testing.T) {
+	router, backend := setupTestRouter(types.Config{Rank: search.RankRecent, RecencyWeight: 2})
+	backend.BulkIndexDocuments(context.Background(), []types.Document{
+		{Title: "Open Access Open Science", PublicationDate: "2012-01-01"},
+		{Title: "Open Access", PublicationDate: time.Now().Format("2006-01-02")},
+	})
+
+	first := func(query string) string {
+		w := serveTestRequest(router, "GET", "/v1/search?q=open"+query, nil)
+		assert.Equal(t, 200, w.Code)
+		return decodeSearchResponse(w).Hits[0].Title
+	}
+	assert.Equal(t, "Open Access", first(""))
+	assert.Equal(t, "Open Access Open Science", first("&rank=relevance"))
+	assert.Equal(t, "Open Access", first("&rank=recent"))
+
+	assert.Equal(t, 400, serveTestRequest(router, "GET", "/v1/search?q=open&rank=newest", nil).Code)
+}
+
+func TestSetupRouterInvalidRanking(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected SetupRouter to panic on an invalid recency scale")
+		}
+	}()
+	setupTestRouter(types.Config{RecencyScale: "1y"})
+}
+
+func TestHandleSearchSort(t *testing.T) {
+	router, backend := setupTestRouter(types.Config{})
+	backend.BulkIndexDocuments(context.Background(), []types.Document{
+		{Title: "Beta", ContentType: "post", PublicationDate: "2020-01-01"},
+		{Title: "Alpha", ContentType: "post", PublicationDate: "2020-01-01"},
+		{Title: "Gamma", ContentType: "book", PublicationDate: "2021-01-01"},
+	})
+
+	get := func(query string) *httptest.ResponseRecorder {
+		return serveTestRequest(router, "GET", "/v1/search?"+query, nil)
+	}
+	titles := func(query string) []string {
+		w := get(query)
+		assert.Equal(t, 200, w.Code)
+		titles := []string{}
+		for _, hit := range decodeSearchResponse(w).Hits {
+			titles = append(titles, hit.Title)
+		}
+		return titles
+	}
+	assert.Equal(t, []string{"Gamma", "Alpha", "Beta"}, titles("sort=publication_date:desc,title.keyword:asc"))
+	assert.Equal(t, []string{"Alpha", "Beta", "Gamma"}, titles("sort=title.keyword"))
+	assert.Equal(t, []string{"Gamma", "Beta", "Alpha"}, titles("sort_by=title.keyword&sort_dir=desc"))
+
+	assert.Equal(t, 400, get("sort=title").Code)
+	assert.Equal(t, 400, get("sort=publication_date:up").Code)
+	assert.Equal(t, 400, get("sort_by=publication_date&sort_dir=up").Code)
+	assert.Equal(t, 400, get("sort=publication_date&sort_by=title.keyword").Code)
+}
@@ -0,0 +1,325 @@
+package api
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/MESH-Research/commons-connect/cc-search/types"
+)
+
+// Permissions that can be granted to an API key.
+const (
+	PermissionRead       = "read"        // Read index information
+	PermissionWrite      = "write"       // Index, update and delete documents
+	PermissionDeleteNode = "delete_node" // Delete every document of a network node
+	PermissionAdmin      = "admin"       // Reset and reindex the index; implies all other permissions
+)
+
+var Permissions = []string{PermissionRead, PermissionWrite, PermissionDeleteNode, PermissionAdmin}
+
+// AllNetworkNodes as a key's network node grants access to every node.
+const AllNetworkNodes = "*"
+
+// Length in bytes of generated tokens and salts.
+const (
+	tokenLength = 32
+	saltLength  = 16
+)
+
+// Number of leading token characters kept in the clear, so that keys can be
+// told apart in listings and logs.
+const tokenPrefixLength = 8
+
+// APIKey is a key that clients authenticate with, bound to the network nodes
+// whose documents it may write and to a set of permissions. Only a salted
+// hash of the token is stored. Several keys may share the same scope, so a
+// key can be rotated by creating its replacement before revoking it.
+type APIKey struct {
+	Name         string     `json:"name"`
+	Prefix       string     `json:"prefix"`
+	Salt         string     `json:"salt"`
+	Hash         string     `json:"hash"`
+	NetworkNodes []string   `json:"network_nodes"`
+	Permissions  []string   `json:"permissions"`
+	CreatedAt    time.Time  `json:"created_at"`
+	ExpiresAt    *time.Time `json:"expires_at,omitempty"`
+}
+
+// The registry file holds the keys in addition to api_key and admin_api_key.
+type keyFile struct {
+	Keys []APIKey `json:"keys"`
+}
+
+func (key APIKey) HasPermission(permission string) bool {
+	return permission == `` ||
+		slices.Contains(key.Permissions, permission) ||
+		slices.Contains(key.Permissions, PermissionAdmin)
+}
+
+// Whether the key may write documents belonging to node.
+func (key APIKey) AllowsNode(node string) bool {
+	return slices.Contains(key.NetworkNodes, AllNetworkNodes) ||
+		(node != `` && slices.Contains(key.NetworkNodes, node))
+}
+
+func (key APIKey) Expired(now time.Time) bool {
+	return key.ExpiresAt != nil && !now.Before(*key.ExpiresAt)
+}
+
+// Whether token is this key's token. Tokens are random, so a single salted
+// SHA-256 is enough to protect them; the comparison takes constant time.
+func (key APIKey) Matches(token string) bool {
+	expected, err := hex.DecodeString(key.Hash)
+	if err != nil {
+		return false
+	}
+	return subtle.ConstantTimeCompare(hashToken(key.Salt, token), expected) == 1
+}
+
+func hashToken(salt string, token string) []byte {
+	hash := sha256.Sum256([]byte(salt + token))
+	return hash[:]
+}
+
+// Returns a random token of tokenLength bytes, hex encoded.
+func GenerateToken(tokenLength int) (string, error) {
+	token := make([]byte, tokenLength)
+	_, err := rand.Read(token)
+	if err != nil {
+		return ``, err
+	}
+	return hex.EncodeToString(token), nil
+}
+
+// Returns a new key for token with a fresh salt.
+func newAPIKey(name string, token string, networkNodes []string, permissions []string) (APIKey, error) {
+	salt, err := GenerateToken(saltLength)
+	if err != nil {
+		return APIKey{}, err
+	}
+	return APIKey{
+		Name:         name,
+		Prefix:       tokenPrefix(token),
+		Salt:         salt,
+		Hash:         hex.EncodeToString(hashToken(salt, token)),
+		NetworkNodes: networkNodes,
+		Permissions:  permissions,
+		CreatedAt:    time.Now().UTC(),
+	}, nil
+}
+
+func tokenPrefix(token string) string {
+	if len(token) <= tokenPrefixLength {
+		return ``
+	}
+	return token[:tokenPrefixLength]
+}
+
+// KeyRegistry holds the API keys accepted by the service. Keys are read from
+// the file set by api_keys_file, which is reloaded when it changes, so keys
+// can be added or revoked without a restart. The api_key and admin_api_key
+// settings are accepted as keys for every network node.
+type KeyRegistry struct {
+	path   string
+	legacy []APIKey
+
+	mu      sync.RWMutex
+	keys    []APIKey
+	modTime time.Time
+}
+
+func NewKeyRegistry(conf types.Config) *KeyRegistry {
+	registry := &KeyRegistry{path: conf.APIKeysFile}
+	legacyKeys := []struct {
+		name        string
+		token       string
+		permissions []string
+	}{
+		{`api_key`, conf.APIKey, []string{PermissionRead, PermissionWrite}},
+		{`admin_api_key`, conf.AdminAPIKey, []string{PermissionAdmin}},
+	}
+	for _, legacyKey := range legacyKeys {
+		if legacyKey.token == `` {
+			continue
+		}
+		key, err := newAPIKey(legacyKey.name, legacyKey.token, []string{AllNetworkNodes}, legacyKey.permissions)
+		if err != nil {
+			log.Println("Error hashing ", legacyKey.name, ": ", err)
+			continue
+		}
+		registry.legacy = append(registry.legacy, key)
+	}
+	registry.reload()
+	return registry
+}
+
+// Returns the unexpired key matching token, if any.
+func (registry *KeyRegistry) Lookup(token string) (APIKey, bool) {
+	registry.reload()
+	registry.mu.RLock()
+	defer registry.mu.RUnlock()
+	now := time.Now()
+	var found APIKey
+	ok := false
+	// Every key is checked, so that timing does not reveal which key matched.
+	for _, keys := range [][]APIKey{registry.legacy, registry.keys} {
+		for _, key := range keys {
+			if key.Matches(token) && !key.Expired(now) && !ok {
+				found = key
+				ok = true
+			}
+		}
+	}
+	return found, ok
+}
+
+// Whether any keys are configured at all.
+func (registry *KeyRegistry) Empty() bool {
+	registry.reload()
+	registry.mu.RLock()
+	defer registry.mu.RUnlock()
+	return len(registry.legacy) == 0 && len(registry.keys) == 0
+}
+
+// reload reads the registry file if it has changed since it was last read. If
+// the file cannot be read the previously loaded keys are kept.
+func (registry *KeyRegistry) reload() {
+	if registry.path == `` {
+		return
+	}
+	info, err := os.Stat(registry.path)
+	if err != nil {
+		log.Println("Error reading API keys file: ", err)
+		return
+	}
+	registry.mu.RLock()
+	unchanged := info.ModTime().Equal(registry.modTime)
+	registry.mu.RUnlock()
+	if unchanged {
+		return
+	}
+	keys, err := LoadKeys(registry.path)
+	if err != nil {
+		log.Println("Error reading API keys file: ", err)
+		return
+	}
+	registry.mu.Lock()
+	registry.keys = keys
+	registry.modTime = info.ModTime()
+	registry.mu.Unlock()
+}
+
+// Reads the keys in the registry file at path. A missing file has no keys.
+func LoadKeys(path string) ([]APIKey, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return []APIKey{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var file keyFile
+	err = json.Unmarshal(data, &file)
+	if err != nil {
+		return nil, errors.New(`error parsing API keys file: ` + err.Error())
+	}
+	for _, key := range file.Keys {
+		if key.Name == `` || key.Salt == `` || key.Hash == `` {
+			return nil, errors.New(`every API key needs a name, salt and hash`)
+		}
+	}
+	return file.Keys, nil
+}
+
+// Writes keys to the registry file at path, replacing it atomically so that
+// a running service never reads a partial file.
+func saveKeys(path string, keys []APIKey) error {
+	data, err := json.MarshalIndent(keyFile{Keys: keys}, "", "\t")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Adds a key to the registry file at path and returns its token. The token is
+// not stored and cannot be recovered. Names must be unique.
+func CreateKey(path string, name string, networkNodes []string, permissions []string, expiresAt *time.Time) (string, error) {
+	if name == `` {
+		return ``, errors.New(`name is required`)
+	}
+	if len(networkNodes) == 0 {
+		return ``, errors.New(`at least one network node is required`)
+	}
+	if len(permissions) == 0 {
+		return ``, errors.New(`at least one permission is required`)
+	}
+	for _, permission := range permissions {
+		if !slices.Contains(Permissions, permission) {
+			return ``, fmt.Errorf(`invalid permission: %s`, permission)
+		}
+	}
+	keys, err := LoadKeys(path)
+	if err != nil {
+		return ``, err
+	}
+	for _, key := range keys {
+		if key.Name == name {
+			return ``, fmt.Errorf(`a key named %s already exists`, name)
+		}
+	}
+	token, err := GenerateToken(tokenLength)
+	if err != nil {
+		return ``, err
+	}
+	key, err := newAPIKey(name, token, networkNodes, permissions)
+	if err != nil {
+		return ``, err
+	}
+	if expiresAt != nil {
+		expires := expiresAt.UTC()
+		key.ExpiresAt = &expires
+	}
+	err = saveKeys(path, append(keys, key))
+	if err != nil {
+		return ``, err
+	}
+	return token, nil
+}
+
+// Removes the key named name from the registry file at path.
+func RevokeKey(path string, name string) error {
+	keys, err := LoadKeys(path)
+	if err != nil {
+		return err
+	}
+	remaining := slices.DeleteFunc(slices.Clone(keys), func(key APIKey) bool {
+		return key.Name == name
+	})
+	if len(remaining) == len(keys) {
+		return fmt.Errorf(`no key named %s`, name)
+	}
+	return saveKeys(path, remaining)
+}
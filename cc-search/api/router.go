@@ -1,47 +1,80 @@
 package api
 
 import (
+	"context"
 	"net/http"
+	"time"
 
+	"github.com/MESH-Research/commons-connect/cc-search/search"
 	"github.com/MESH-Research/commons-connect/cc-search/types"
 	"github.com/gin-gonic/gin"
 )
 
-func SetupRouter(searcher types.Searcher, conf types.Config) *gin.Engine {
+// Default time allowed for requests to each group of endpoints.
+const (
+	defaultSearchTimeout   = 10 * time.Second
+	defaultDocumentTimeout = 10 * time.Second
+	defaultBulkTimeout     = time.Minute
+	defaultIndexTimeout    = 10 * time.Minute
+)
+
+// SetupRouter returns the router of the API. It panics if conf sets an invalid
+// ranking, so that the service fails at startup rather than on each search.
+func SetupRouter(backend search.Backend, conf types.Config) *gin.Engine {
+	if err := search.ValidateRanking(conf); err != nil {
+		panic(err)
+	}
 	router := gin.Default()
+	// Match routes against the escaped path so that IDs in the URL may
+	// contain encoded slashes.
+	router.UseRawPath = true
 
-	router.Use(OSMiddleware(searcher))
+	router.Use(BackendMiddleware(backend))
 	router.Use(ConfigMiddleware(conf))
+	router.Use(KeysMiddleware(NewKeyRegistry(conf)))
 
 	router.GET("/", func(c *gin.Context) {
 		c.String(http.StatusOK, "OK")
 	})
 
+	searchTimeout := TimeoutMiddleware(timeoutOrDefault(conf.SearchTimeout, defaultSearchTimeout))
+	documentTimeout := TimeoutMiddleware(timeoutOrDefault(conf.DocumentTimeout, defaultDocumentTimeout))
+	bulkTimeout := TimeoutMiddleware(timeoutOrDefault(conf.BulkTimeout, defaultBulkTimeout))
+	indexTimeout := TimeoutMiddleware(timeoutOrDefault(conf.IndexTimeout, defaultIndexTimeout))
+
+	viewer := ViewerMiddleware(conf.ViewerSecret)
+
 	v1 := router.Group("/v1")
 
 	v1.GET("/ping", handlePing)
 
-	v1.GET("/index", validateAPIToken, handleGetIndex)
-	v1.POST("/index", validateAdminAPIToken, handleResetIndex)
-	v1.GET("/auth_check", validateAPIToken, handleAuthCheck)
-	v1.GET("/admin_auth_check", validateAdminAPIToken, handleAuthCheck)
+	v1.GET("/index", requirePermission(PermissionRead), indexTimeout, handleGetIndex)
+	v1.POST("/index", requirePermission(PermissionAdmin), indexTimeout, handleResetIndex)
+	v1.POST("/index/reindex", requirePermission(PermissionAdmin), indexTimeout, handleReindex)
+	v1.GET("/auth_check", requirePermission(""), handleAuthCheck)
+	v1.GET("/admin_auth_check", requirePermission(PermissionAdmin), handleAuthCheck)
 
-	v1.GET("/documents/:id", handleGetDocument)
-	v1.POST("/documents", validateAPIToken, handleNewDocument)
-	v1.PUT("/documents/:id", validateAPIToken, handleUpdateDocument)
-	v1.DELETE("/documents/:id", validateAPIToken, handleDeleteDocument)
-	v1.DELETE("/documents", validateAdminAPIToken, handleDeleteNode)
-	v1.POST("/documents/bulk", validateAPIToken, handleBulkNewDocuments)
+	v1.GET("/documents/:id", viewer, documentTimeout, handleGetDocument)
+	v1.GET("/documents/:id/related", viewer, searchTimeout, handleRelatedDocuments)
+	v1.POST("/documents", requirePermission(PermissionWrite), documentTimeout, handleNewDocument)
+	v1.PUT("/documents/:id", requirePermission(PermissionWrite), documentTimeout, handleUpdateDocument)
+	v1.PUT("/documents/by-internal-id/:network_node/:internal_id", requirePermission(PermissionWrite), documentTimeout, handleUpsertDocument)
+	v1.DELETE("/documents/:id", requirePermission(PermissionWrite), documentTimeout, handleDeleteDocument)
+	v1.DELETE("/documents", requirePermission(PermissionDeleteNode), bulkTimeout, handleDeleteNode)
+	v1.POST("/documents/bulk", requirePermission(PermissionWrite), bulkTimeout, handleBulkNewDocuments)
+	v1.POST("/documents/bulk/update", requirePermission(PermissionWrite), bulkTimeout, handleBulkUpdateDocuments)
+	v1.POST("/documents/bulk/upsert", requirePermission(PermissionWrite), bulkTimeout, handleBulkUpsertDocuments)
+	v1.POST("/documents/bulk/delete", requirePermission(PermissionWrite), bulkTimeout, handleBulkDeleteDocuments)
 
-	v1.GET("/search", handleSearch)
-	v1.GET("/typeahead", handleTypeAheadSearch)
+	v1.GET("/search", viewer, searchTimeout, handleSearch)
+	v1.GET("/typeahead", viewer, searchTimeout, handleTypeAheadSearch)
 
 	return router
 }
 
-func OSMiddleware(searcher types.Searcher) gin.HandlerFunc {
+func BackendMiddleware(backend search.Backend) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		c.Set("searcher", searcher)
+		c.Set("backend", backend)
 		c.Next()
 	}
 }
@@ -52,3 +85,29 @@ func ConfigMiddleware(conf types.Config) gin.HandlerFunc {
 		c.Next()
 	}
 }
+
+// TimeoutMiddleware sets a deadline on the request context. Requests to
+// OpenSearch made with the context are cancelled when it expires, and
+// handlers respond with 504 Gateway Timeout.
+func TimeoutMiddleware(timeout time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+		defer cancel()
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+	}
+}
+
+func timeoutOrDefault(timeout time.Duration, defaultTimeout time.Duration) time.Duration {
+	if timeout > 0 {
+		return timeout
+	}
+	return defaultTimeout
+}
+
+func KeysMiddleware(keys *KeyRegistry) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set("keys", keys)
+		c.Next()
+	}
+}
@@ -0,0 +1,93 @@
+package api
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/MESH-Research/commons-connect/cc-search/types"
+	"github.com/gin-gonic/gin"
+)
+
+// ViewerHeader carries the signed viewer context of a request.
+const ViewerHeader = "X-CC-Viewer"
+
+// viewerClaims is the payload of a viewer context: the viewer and the Unix
+// time after which the context is no longer accepted.
+type viewerClaims struct {
+	types.Viewer
+	ExpiresAt int64 `json:"exp"`
+}
+
+// SignViewer returns a viewer context for viewer, valid until expiresAt and
+// signed with secret. Trusted clients pass it in the X-CC-Viewer header. The
+// context is the base64url-encoded JSON claims and their base64url-encoded
+// HMAC-SHA256, separated by a dot.
+func SignViewer(secret string, viewer types.Viewer, expiresAt time.Time) (string, error) {
+	payload, err := json.Marshal(viewerClaims{Viewer: viewer, ExpiresAt: expiresAt.Unix()})
+	if err != nil {
+		return ``, err
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(viewerSignature(secret, encoded)), nil
+}
+
+func viewerSignature(secret string, encodedPayload string) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(encodedPayload))
+	return mac.Sum(nil)
+}
+
+// Verifies a viewer context signed by SignViewer and returns its viewer.
+func ParseViewer(secret string, signed string, now time.Time) (*types.Viewer, error) {
+	if secret == `` {
+		return nil, errors.New(`no viewer secret configured`)
+	}
+	encoded, signature, found := strings.Cut(signed, ".")
+	if !found {
+		return nil, errors.New(`misformatted viewer context`)
+	}
+	decodedSignature, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || !hmac.Equal(decodedSignature, viewerSignature(secret, encoded)) {
+		return nil, errors.New(`invalid viewer signature`)
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, errors.New(`misformatted viewer context`)
+	}
+	var claims viewerClaims
+	err = json.Unmarshal(payload, &claims)
+	if err != nil {
+		return nil, errors.New(`error parsing viewer context: ` + err.Error())
+	}
+	if claims.ExpiresAt == 0 || !now.Before(time.Unix(claims.ExpiresAt, 0)) {
+		return nil, errors.New(`viewer context expired`)
+	}
+	return &claims.Viewer, nil
+}
+
+// ViewerMiddleware stores the request's viewer in the context as "viewer".
+// Requests without a viewer context are anonymous; requests with an invalid
+// one are rejected with 401.
+func ViewerMiddleware(secret string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		viewer := &types.Viewer{}
+		if header := c.GetHeader(ViewerHeader); header != `` {
+			var err error
+			viewer, err = ParseViewer(secret, header, time.Now())
+			if err != nil {
+				log.Println("Failed viewer validation: ", err)
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid viewer context"})
+				return
+			}
+		}
+		c.Set("viewer", viewer)
+		c.Next()
+	}
+}
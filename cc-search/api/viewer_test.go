@@ -0,0 +1,108 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MESH-Research/commons-connect/cc-search/types"
+	"github.com/go-playground/assert/v2"
+)
+
+const testViewerSecret = "viewer-secret"
+
+func TestParseViewer(t *testing.T) {
+	now := time.Now()
+	signed, err := SignViewer(testViewerSecret, types.Viewer{Username: "jdoe", Groups: []string{"editors"}}, now.Add(time.Minute))
+	if err != nil {
+		t.Fatalf("Error signing viewer: %v", err)
+	}
+	viewer, err := ParseViewer(testViewerSecret, signed, now)
+	if err != nil {
+		t.Fatalf("Error parsing viewer: %v", err)
+	}
+	if viewer.Username != "jdoe" || len(viewer.Groups) != 1 || viewer.Groups[0] != "editors" {
+		t.Errorf("Expected jdoe in editors, got %+v", viewer)
+	}
+
+	payload, signature, _ := strings.Cut(signed, ".")
+	forged, _ := SignViewer("other-secret", types.Viewer{Username: "admin"}, now.Add(time.Minute))
+	forgedPayload, _, _ := strings.Cut(forged, ".")
+	invalid := map[string]struct {
+		secret string
+		signed string
+		now    time.Time
+	}{
+		"wrong secret":      {"other-secret", signed, now},
+		"no secret":         {"", signed, now},
+		"expired":           {testViewerSecret, signed, now.Add(time.Hour)},
+		"swapped payload":   {testViewerSecret, forgedPayload + "." + signature, now},
+		"missing signature": {testViewerSecret, payload, now},
+		"not base64":        {testViewerSecret, "!." + signature, now},
+	}
+	for name, tt := range invalid {
+		if _, err := ParseViewer(tt.secret, tt.signed, tt.now); err == nil {
+			t.Errorf("%s: expected error, got nil", name)
+		}
+	}
+}
+
+func TestVisibilityFiltering(t *testing.T) {
+	router, backend := setupTestRouter(types.Config{ViewerSecret: testViewerSecret})
+	ctx := context.Background()
+	public, _ := backend.IndexDocument(ctx, types.Document{Title: "Public Minutes"})
+	private, _ := backend.IndexDocument(ctx, types.Document{
+		Title:         "Private Minutes",
+		Visibility:    types.VisibilityPrivate,
+		AllowedGroups: []string{"editors"},
+		Owner:         types.User{Name: "Ann Smith", Username: "asmith"},
+	})
+
+	editor, _ := SignViewer(testViewerSecret, types.Viewer{Username: "jdoe", Groups: []string{"editors"}}, time.Now().Add(time.Minute))
+	forged, _ := SignViewer("other-secret", types.Viewer{Username: "jdoe", Groups: []string{"editors"}}, time.Now().Add(time.Minute))
+
+	get := func(url string, viewer string) *httptest.ResponseRecorder {
+		if viewer == "" {
+			return serveTestRequest(router, "GET", url, nil)
+		}
+		return serveTestRequest(router, "GET", url, nil, ViewerHeader, viewer)
+	}
+	searchTotal := func(viewer string) int64 {
+		w := get("/v1/search?q=minutes", viewer)
+		assert.Equal(t, 200, w.Code)
+		return decodeSearchResponse(w).Total
+	}
+
+	assert.Equal(t, int64(1), searchTotal(""))
+	assert.Equal(t, int64(2), searchTotal(editor))
+	assert.Equal(t, 401, get("/v1/search?q=minutes", forged).Code)
+
+	var documents []types.Document
+	json.NewDecoder(get("/v1/typeahead?q=min", "").Body).Decode(&documents)
+	assert.Equal(t, 1, len(documents))
+	json.NewDecoder(get("/v1/typeahead?q=min", editor).Body).Decode(&documents)
+	assert.Equal(t, 2, len(documents))
+
+	assert.Equal(t, 200, get("/v1/documents/"+public.ID, "").Code)
+	assert.Equal(t, 404, get("/v1/documents/"+private.ID, "").Code)
+	assert.Equal(t, 200, get("/v1/documents/"+private.ID, editor).Code)
+
+	// Readers are not shown who else may view a document.
+	for _, url := range []string{"/v1/documents/" + private.ID, "/v1/search?q=minutes", "/v1/typeahead?q=min"} {
+		body := get(url, editor).Body.String()
+		if strings.Contains(body, "allowed_groups") {
+			t.Errorf("%s: expected access lists to be hidden, got %s", url, body)
+		}
+	}
+	if body := get("/v1/documents/"+private.ID, editor).Body.String(); !strings.Contains(body, "asmith") {
+		t.Errorf("Expected the owner's username to be returned, got %s", body)
+	}
+
+	// Emptying allowed_groups revokes the group's access.
+	assert.Equal(t, 200, sendJSON(router, "PUT", "/v1/documents/"+private.ID, testAPIKey, map[string]interface{}{"allowed_groups": []string{}}))
+	assert.Equal(t, 404, get("/v1/documents/"+private.ID, editor).Code)
+	assert.Equal(t, int64(1), searchTotal(editor))
+}
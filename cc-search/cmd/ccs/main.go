@@ -9,15 +9,14 @@ package main
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
-	"log"
 	"os"
 	"strconv"
 	"strings"
 	"text/tabwriter"
 	"time"
 
+	"github.com/MESH-Research/commons-connect/cc-search/api"
 	"github.com/MESH-Research/commons-connect/cc-search/config"
 	"github.com/MESH-Research/commons-connect/cc-search/search"
 	"github.com/MESH-Research/commons-connect/cc-search/types"
@@ -41,6 +40,10 @@ type ParsedArgs struct {
 	NamedArgs      map[string]string
 }
 
+// Returns the backend commands run against. Tests replace it with an
+// in-memory backend.
+var getBackend = search.GetBackend
+
 var commands = map[string]Command{
 	"status": {
 		Description:            "Get the status of the search service",
@@ -77,28 +80,71 @@ var commands = map[string]Command{
 		NamedArgs:              map[string]string{},
 		Runner:                 cmdReset,
 	},
+	"mapping-diff": {
+		Description:            "Compare the live index mappings and settings with the index settings built into ccs",
+		Usage:                  "ccs mapping-diff",
+		RequiredPositionalArgs: []RequiredPositionalArg{},
+		NamedArgs:              map[string]string{},
+		Runner:                 cmdMappingDiff,
+	},
+	"reindex": {
+		Description:            "Rebuild the search index with the current index settings without downtime",
+		Usage:                  "ccs reindex",
+		RequiredPositionalArgs: []RequiredPositionalArg{},
+		NamedArgs:              map[string]string{},
+		Runner:                 cmdReindex,
+	},
 	"search": {
 		Description:            "Search for documents",
 		Usage:                  "ccs search [options]",
 		RequiredPositionalArgs: []RequiredPositionalArg{},
 		NamedArgs: map[string]string{
-			"query":        "The search query",
-			"limit":        "The maximum number of results to return",
-			"username":     "Search only documents with this username as a contributor",
-			"start-date":   "Search only documents published after this date (YYYY-MM-DD)",
-			"end-date":     "Search only documents published before this date (YYYY-MM-DD)",
-			"title":        "Search only documents with this title",
-			"content-type": "Search only documents with this content type",
-			"network":      "Search only documents with this network node",
+			"query":         "The search query",
+			"search-fields": "Comma-separated fields to search, with optional boosts (eg. title^3,content)",
+			"limit":         "The maximum number of results to return",
+			"username":      "Search only documents with one of these comma-separated usernames as a contributor",
+			"start-date":    "Search only documents published on or after this date (YYYY-MM-DD, RFC 3339 or date math such as now-7d)",
+			"end-date":      "Search only documents published on or before this date (YYYY-MM-DD, RFC 3339 or date math such as now-7d)",
+			"date-field":    "The date field that start-date and end-date apply to (default publication_date)",
+			"rank":          "Rank results by relevance, or boost recently published documents with recent",
+			"title":         "Search only documents with exactly this whole title",
+			"content-type":  "Search only documents with one of these comma-separated content types",
+			"network":       "Search only documents with one of these comma-separated network nodes",
 		},
 		Runner: cmdSearch,
 	},
+	"token create": {
+		Description:            "Create an API key and print its token",
+		Usage:                  "ccs token create <name> --network-nodes=<nodes> [options]",
+		RequiredPositionalArgs: []RequiredPositionalArg{{Name: "name", Description: "A unique name for the key"}},
+		NamedArgs: map[string]string{
+			"network-nodes": "Comma-separated network nodes the key may write to, or * for all",
+			"permissions":   "Comma-separated permissions: read, write, delete_node, admin (default write)",
+			"expires":       "When the key expires, as a date (YYYY-MM-DD), a timestamp (RFC 3339) or a duration from now (eg. 2160h)",
+		},
+		Runner: cmdTokenCreate,
+	},
+	"token list": {
+		Description:            "List API keys",
+		Usage:                  "ccs token list",
+		RequiredPositionalArgs: []RequiredPositionalArg{},
+		NamedArgs:              map[string]string{},
+		Runner:                 cmdTokenList,
+	},
+	"token revoke": {
+		Description:            "Revoke an API key",
+		Usage:                  "ccs token revoke <name>",
+		RequiredPositionalArgs: []RequiredPositionalArg{{Name: "name", Description: "The name of the key to revoke"}},
+		NamedArgs:              map[string]string{},
+		Runner:                 cmdTokenRevoke,
+	},
 }
 
 func main() {
 	if len(os.Args) < 2 || contains(os.Args, "--help") || contains(os.Args, "-h") {
 		if len(os.Args) > 1 {
-			showHelp(os.Args[1])
+			commandName, _ := splitCommand(os.Args[1:])
+			showHelp(commandName)
 		} else {
 			showHelp("")
 		}
@@ -112,7 +158,8 @@ func main() {
 // Parse the arguments for a command
 // Returns the positional and named arguments
 //
-// The first argument is the command name. Further arguments are parsed as follows:
+// The first argument is the command name, or the first two for commands with
+// subcommands, such as "token create". Further arguments are parsed as follows:
 //   - Named arguments are formatted as --key=value (no spaces between the = sign)
 //   - Positional arguments are formatted as value. They must come before named arguments and are required.
 //
@@ -124,13 +171,13 @@ func parseArgs(args []string) (commandName string, parsedArgs ParsedArgs) {
 	positionalArgs := map[string]string{}
 	namedArgs := map[string]string{}
 
-	commandName = args[0]
+	commandName, args = splitCommand(args)
 	command, ok := commands[commandName]
 	if !ok {
 		panic(fmt.Sprintf("Invalid command: %s", commandName))
 	}
 
-	for position, arg := range args[1:] {
+	for position, arg := range args {
 		if strings.HasPrefix(arg, "--") {
 			argName, argValue, found := strings.Cut(arg, "=")
 			argName = strings.TrimPrefix(argName, "--")
@@ -154,6 +201,16 @@ func parseArgs(args []string) (commandName string, parsedArgs ParsedArgs) {
 	return commandName, ParsedArgs{PositionalArgs: positionalArgs, NamedArgs: namedArgs}
 }
 
+// Splits the command name from its arguments.
+func splitCommand(args []string) (commandName string, commandArgs []string) {
+	if len(args) > 1 {
+		if _, ok := commands[args[0]+" "+args[1]]; ok {
+			return args[0] + " " + args[1], args[2:]
+		}
+	}
+	return args[0], args[1:]
+}
+
 func showHelp(commandName string) {
 	fmt.Println("Commons Connect Search CLI")
 	fmt.Println()
@@ -191,6 +248,7 @@ func showHelp(commandName string) {
 
 type SearchServiceStatus struct {
 	IndexName           string
+	PhysicalIndexName   string
 	SearchEndpoint      string
 	SearchUsername      string
 	SearchPasswordIsSet bool
@@ -203,14 +261,25 @@ type SearchServiceStatus struct {
 
 func cmdStatus(_ ParsedArgs) {
 	conf := config.GetConfig()
-	searcher := search.GetSearcher(conf)
-	indexSettings, err := search.GetIndexInfo(&searcher)
+	backend := getBackend(conf)
+	indexSettings, err := backend.GetIndexInfo(context.Background())
 	if err != nil {
 		fmt.Println("Error getting index info:", err)
 		return
 	}
 
-	indexData, ok := indexSettings[conf.IndexName].(map[string]interface{})
+	// The index is an alias, so the info is keyed by the physical index behind it.
+	if len(indexSettings) != 1 {
+		fmt.Println("Unexpected index data structure")
+		return
+	}
+	var physicalIndexName string
+	var indexData map[string]interface{}
+	ok := false
+	for name, data := range indexSettings {
+		physicalIndexName = name
+		indexData, ok = data.(map[string]interface{})
+	}
 	if !ok {
 		fmt.Println("Unexpected index data structure")
 		return
@@ -232,41 +301,20 @@ func cmdStatus(_ ParsedArgs) {
 	numReplicas, _ := strconv.Atoi(indexSettings["number_of_replicas"].(string))
 	numShards, _ := strconv.Atoi(indexSettings["number_of_shards"].(string))
 
-	response, err := searcher.Client.Count(
-		searcher.Client.Count.WithIndex(conf.IndexName),
-		searcher.Client.Count.WithContext(context.Background()),
-	)
+	count, err := backend.CountDocuments(context.Background())
 	if err != nil {
 		fmt.Println("Error getting document count:", err)
 		return
 	}
 
-	if response.StatusCode != 200 {
-		fmt.Println("Error getting document count:", response.StatusCode)
-		return
-	}
-
-	defer response.Body.Close()
-
-	var r map[string]interface{}
-	if err := json.NewDecoder(response.Body).Decode(&r); err != nil {
-		log.Fatalf("Error parsing the response body: %s", err)
-	}
-
-	count := r["count"].(float64)
-	countInt, err := strconv.Atoi(fmt.Sprintf("%d", int(count)))
-	if err != nil {
-		fmt.Println("Error converting document count to int:", err)
-		return
-	}
-
 	status := SearchServiceStatus{
 		IndexName:           conf.IndexName,
+		PhysicalIndexName:   physicalIndexName,
 		SearchEndpoint:      conf.SearchEndpoint,
 		SearchUsername:      conf.User,
 		SearchPasswordIsSet: conf.Password != "",
 		APIKey:              conf.APIKey,
-		NumDocs:             countInt,
+		NumDocs:             int(count),
 		CreationTime:        time.Unix(creationDate/1000, 0),
 		NumReplicas:         numReplicas,
 		NumShards:           numShards,
@@ -274,6 +322,7 @@ func cmdStatus(_ ParsedArgs) {
 
 	fmt.Printf("Index Status:\n")
 	fmt.Printf("  Index Name: %s\n", status.IndexName)
+	fmt.Printf("  Physical Index Name: %s\n", status.PhysicalIndexName)
 	fmt.Printf("  Search Endpoint: %s\n", status.SearchEndpoint)
 	fmt.Printf("  Search Username: %s\n", status.SearchUsername)
 	fmt.Printf("  Search Password is set: %v\n", status.SearchPasswordIsSet)
@@ -286,8 +335,8 @@ func cmdStatus(_ ParsedArgs) {
 
 func cmdGet(args ParsedArgs) {
 	conf := config.GetConfig()
-	searcher := search.GetSearcher(conf)
-	document, err := search.GetDocument(searcher, args.PositionalArgs["id"])
+	backend := getBackend(conf)
+	document, err := backend.GetDocument(context.Background(), args.PositionalArgs["id"])
 	if err != nil {
 		fmt.Println("Error getting document:", err)
 		return
@@ -323,9 +372,9 @@ func printUsers(users []types.User) {
 
 func cmdDelete(args ParsedArgs) {
 	conf := config.GetConfig()
-	searcher := search.GetSearcher(conf)
+	backend := getBackend(conf)
 
-	document, err := search.GetDocument(searcher, args.PositionalArgs["id"])
+	document, err := backend.GetDocument(context.Background(), args.PositionalArgs["id"])
 	if err != nil {
 		fmt.Println("Error getting document:", err)
 		return
@@ -346,7 +395,7 @@ func cmdDelete(args ParsedArgs) {
 		return
 	}
 
-	err = search.DeleteDocument(searcher, args.PositionalArgs["id"])
+	err = backend.DeleteDocument(context.Background(), args.PositionalArgs["id"])
 	if err != nil {
 		fmt.Println("Error deleting document:", err)
 		return
@@ -356,7 +405,7 @@ func cmdDelete(args ParsedArgs) {
 
 func cmdDeleteNode(args ParsedArgs) {
 	conf := config.GetConfig()
-	searcher := search.GetSearcher(conf)
+	backend := getBackend(conf)
 
 	fmt.Println("Deleting documents from network node: " + args.PositionalArgs["network-node"])
 	fmt.Print("Are you sure you want to delete all documents from this network node? (y/N): ")
@@ -367,7 +416,7 @@ func cmdDeleteNode(args ParsedArgs) {
 		return
 	}
 
-	err := search.DeleteNode(searcher, args.PositionalArgs["network-node"])
+	err := backend.DeleteNode(context.Background(), args.PositionalArgs["network-node"])
 	if err != nil {
 		fmt.Println("Error deleting documents:", err)
 		return
@@ -377,7 +426,7 @@ func cmdDeleteNode(args ParsedArgs) {
 
 func cmdReset(_ ParsedArgs) {
 	conf := config.GetConfig()
-	searcher := search.GetSearcher(conf)
+	backend := getBackend(conf)
 
 	fmt.Println("Resetting index")
 	fmt.Print("Are you sure you want to reset the index? This will delete all documents and reset the index. (y/N): ")
@@ -388,7 +437,7 @@ func cmdReset(_ ParsedArgs) {
 		return
 	}
 
-	err := search.ResetIndex(&searcher)
+	err := backend.ResetIndex(context.Background())
 	if err != nil {
 		fmt.Println("Error resetting index:", err)
 		return
@@ -396,34 +445,123 @@ func cmdReset(_ ParsedArgs) {
 	fmt.Println("Index reset")
 }
 
+func cmdMappingDiff(_ ParsedArgs) {
+	conf := config.GetConfig()
+	backend := getBackend(conf)
+	indexInfo, err := backend.GetIndexInfo(context.Background())
+	if err != nil {
+		fmt.Println("Error getting index info:", err)
+		return
+	}
+	drift, err := search.IndexMappingDrift(indexInfo)
+	if err != nil {
+		fmt.Println("Error comparing mappings:", err)
+		return
+	}
+
+	for index, indexDrift := range drift {
+		fmt.Println("Index: " + index)
+		if indexDrift.InSync {
+			fmt.Println("  Mappings and settings match")
+			continue
+		}
+		if len(indexDrift.Added) > 0 {
+			fmt.Println("  Added (in index only):")
+			for _, field := range indexDrift.Added {
+				fmt.Println("    + " + field)
+			}
+		}
+		if len(indexDrift.Missing) > 0 {
+			fmt.Println("  Missing (in settings only):")
+			for _, field := range indexDrift.Missing {
+				fmt.Println("    - " + field)
+			}
+		}
+		if len(indexDrift.Changed) > 0 {
+			fmt.Println("  Changed:")
+			for _, change := range indexDrift.Changed {
+				fmt.Printf("    ~ %s: expected %s, got %s\n", change.Field, change.Expected, change.Actual)
+			}
+		}
+		fmt.Println("  Run 'ccs reindex' to rebuild the index with the current settings.")
+	}
+}
+
+func cmdReindex(_ ParsedArgs) {
+	conf := config.GetConfig()
+	backend := getBackend(conf)
+
+	fmt.Println("Reindexing " + conf.IndexName)
+	fmt.Print("Are you sure you want to reindex? Indexing, updating and deleting documents will be rejected until the reindex finishes. (y/N): ")
+	var response string
+	fmt.Scanln(&response)
+	if strings.ToLower(response) != "y" {
+		fmt.Println("Reindex aborted.")
+		return
+	}
+
+	result, err := backend.Reindex(context.Background())
+	if err != nil {
+		fmt.Println("Error reindexing:", err)
+		return
+	}
+	fmt.Printf("Copied %d documents from %s to %s\n", result.Documents, strings.Join(result.PreviousIndices, ", "), result.NewIndex)
+	fmt.Println("Reindex complete")
+}
+
 func cmdSearch(args ParsedArgs) {
 	conf := config.GetConfig()
-	searcher := search.GetSearcher(conf)
+	backend := getBackend(conf)
 
 	params := types.SearchParams{
-		ExactMatch: make(map[string]string),
+		ExactMatch: make(map[string][]string),
 	}
 
 	if args.NamedArgs["query"] != "" {
 		params.Query = args.NamedArgs["query"]
 	}
+	searchFields, err := search.ConfiguredSearchFields(conf)
+	if args.NamedArgs["search-fields"] != "" {
+		searchFields, err = search.ParseSearchFields(args.NamedArgs["search-fields"])
+	}
+	if err != nil {
+		fmt.Println("Invalid search fields:", err)
+		return
+	}
+	params.SearchFields = searchFields
 	if args.NamedArgs["username"] != "" {
-		params.ExactMatch["contributors.username"] = args.NamedArgs["username"]
+		params.ExactMatch["contributors.username"] = splitList(args.NamedArgs["username"])
 	}
 	if args.NamedArgs["title"] != "" {
-		params.ExactMatch["title"] = args.NamedArgs["title"]
+		params.ExactMatch["title.keyword"] = []string{args.NamedArgs["title"]}
 	}
 	if args.NamedArgs["content-type"] != "" {
-		params.ExactMatch["content_type"] = args.NamedArgs["content-type"]
+		params.ExactMatch["content_type"] = splitList(args.NamedArgs["content-type"])
 	}
 	if args.NamedArgs["network"] != "" {
-		params.ExactMatch["network_node"] = args.NamedArgs["network"]
+		params.ExactMatch["network_node"] = splitList(args.NamedArgs["network"])
 	}
-	if args.NamedArgs["start-date"] != "" {
-		params.StartDate = args.NamedArgs["start-date"]
+	for name, date := range map[string]*string{"start-date": &params.StartDate, "end-date": &params.EndDate} {
+		if args.NamedArgs[name] == "" {
+			continue
+		}
+		if err := search.ValidateDate(args.NamedArgs[name]); err != nil {
+			fmt.Println("Invalid "+name+":", err)
+			return
+		}
+		*date = args.NamedArgs[name]
 	}
-	if args.NamedArgs["end-date"] != "" {
-		params.EndDate = args.NamedArgs["end-date"]
+	if args.NamedArgs["date-field"] != "" {
+		if err := search.ValidateDateField(args.NamedArgs["date-field"]); err != nil {
+			fmt.Println("Invalid date field:", err)
+			return
+		}
+		params.DateField = args.NamedArgs["date-field"]
+	}
+	params.Recency, err = search.RecencyBoost(conf, args.NamedArgs["rank"])
+	if err != nil {
+		fmt.Println("Invalid rank:", err)
+		return
 	}
 	if args.NamedArgs["limit"] != "" {
 		limit, err := strconv.Atoi(args.NamedArgs["limit"])
@@ -434,7 +572,7 @@ func cmdSearch(args ParsedArgs) {
 		params.PerPage = limit
 	}
 
-	searchResult, err := search.Search(searcher, params)
+	searchResult, err := backend.Search(context.Background(), params)
 	if err != nil {
 		fmt.Println("Error searching for documents:", err)
 		return
@@ -457,6 +595,117 @@ func cmdSearch(args ParsedArgs) {
 	w.Flush()
 }
 
+func cmdTokenCreate(args ParsedArgs) {
+	conf := config.GetConfig()
+	if conf.APIKeysFile == "" {
+		fmt.Println("No API keys file set. Set api_keys_file in the config or CC_API_KEYS_FILE.")
+		return
+	}
+
+	networkNodes := splitList(args.NamedArgs["network-nodes"])
+	permissions := splitList(args.NamedArgs["permissions"])
+	if len(permissions) == 0 {
+		permissions = []string{api.PermissionWrite}
+	}
+	var expiresAt *time.Time
+	if args.NamedArgs["expires"] != "" {
+		expires, err := parseExpiry(args.NamedArgs["expires"], time.Now())
+		if err != nil {
+			fmt.Println("Invalid expiry:", err)
+			return
+		}
+		expiresAt = &expires
+	}
+
+	token, err := api.CreateKey(conf.APIKeysFile, args.PositionalArgs["name"], networkNodes, permissions, expiresAt)
+	if err != nil {
+		fmt.Println("Error creating key:", err)
+		return
+	}
+	fmt.Println("Created key " + args.PositionalArgs["name"])
+	fmt.Println("Token: " + token)
+	fmt.Println("The token is not stored and will not be shown again.")
+}
+
+// Parses an expiry given as a date, an RFC 3339 timestamp or a duration from now.
+func parseExpiry(value string, now time.Time) (time.Time, error) {
+	if expires, err := time.Parse("2006-01-02", value); err == nil {
+		return expires, nil
+	}
+	if expires, err := time.Parse(time.RFC3339, value); err == nil {
+		return expires, nil
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("expected a date, timestamp or duration, got %s", value)
+	}
+	return now.Add(duration), nil
+}
+
+func splitList(value string) []string {
+	items := []string{}
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func cmdTokenList(_ ParsedArgs) {
+	conf := config.GetConfig()
+	if conf.APIKeysFile == "" {
+		fmt.Println("No API keys file set. Set api_keys_file in the config or CC_API_KEYS_FILE.")
+		return
+	}
+	keys, err := api.LoadKeys(conf.APIKeysFile)
+	if err != nil {
+		fmt.Println("Error reading keys:", err)
+		return
+	}
+
+	now := time.Now()
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 1, ' ', tabwriter.Debug)
+	fmt.Fprintln(w, "Name\tPrefix\tNetwork Nodes\tPermissions\tCreated\tExpires")
+	fmt.Fprintln(w, "----\t------\t-------------\t-----------\t-------\t-------")
+	for _, key := range keys {
+		expires := "never"
+		if key.ExpiresAt != nil {
+			expires = key.ExpiresAt.Format(time.RFC3339)
+			if key.Expired(now) {
+				expires += " (expired)"
+			}
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", key.Name, key.Prefix, strings.Join(key.NetworkNodes, ","), strings.Join(key.Permissions, ","), key.CreatedAt.Format(time.RFC3339), expires)
+	}
+	w.Flush()
+}
+
+func cmdTokenRevoke(args ParsedArgs) {
+	conf := config.GetConfig()
+	if conf.APIKeysFile == "" {
+		fmt.Println("No API keys file set. Set api_keys_file in the config or CC_API_KEYS_FILE.")
+		return
+	}
+
+	fmt.Println("Revoking key: " + args.PositionalArgs["name"])
+	fmt.Print("Are you sure you want to revoke this key? Clients using it will be rejected. (y/N): ")
+	var response string
+	fmt.Scanln(&response)
+	if strings.ToLower(response) != "y" {
+		fmt.Println("Key revocation aborted.")
+		return
+	}
+
+	err := api.RevokeKey(conf.APIKeysFile, args.PositionalArgs["name"])
+	if err != nil {
+		fmt.Println("Error revoking key:", err)
+		return
+	}
+	fmt.Println("Key revoked")
+}
+
 func contains(slice []string, item string) bool {
 	for _, s := range slice {
 		if s == item {
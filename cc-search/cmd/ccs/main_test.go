@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MESH-Research/commons-connect/cc-search/api"
+	"github.com/MESH-Research/commons-connect/cc-search/search"
+	"github.com/MESH-Research/commons-connect/cc-search/types"
+)
+
+// useMemoryBackend points commands at an in-memory backend for the duration
+// of the test.
+func useMemoryBackend(t *testing.T) *search.MemoryBackend {
+	backend := search.NewMemoryBackend("test")
+	getBackend = func(types.Config) search.Backend { return backend }
+	t.Cleanup(func() { getBackend = search.GetBackend })
+	return backend
+}
+
+// captureOutput returns what run writes to stdout.
+func captureOutput(t *testing.T, run func()) string {
+	stdout := os.Stdout
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("Error creating pipe: %v", err)
+	}
+	os.Stdout = w
+	run()
+	w.Close()
+	os.Stdout = stdout
+	output, _ := io.ReadAll(r)
+	return string(output)
+}
+
+func TestCmdGet(t *testing.T) {
+	backend := useMemoryBackend(t)
+	document, err := backend.IndexDocument(context.Background(), types.Document{
+		Title:       "Searching Openly",
+		NetworkNode: "hc",
+	})
+	if err != nil {
+		t.Fatalf("Error indexing document: %v", err)
+	}
+
+	_, args := parseArgs([]string{"get", document.ID})
+	output := captureOutput(t, func() { cmdGet(args) })
+	if !strings.Contains(output, "Title: Searching Openly") {
+		t.Errorf("Expected document title in output, got %q", output)
+	}
+}
+
+func TestCmdSearch(t *testing.T) {
+	backend := useMemoryBackend(t)
+	_, err := backend.BulkIndexDocuments(context.Background(), []types.Document{
+		{Title: "Searching Openly", NetworkNode: "hc"},
+		{Title: "Open Access", NetworkNode: "mla"},
+	})
+	if err != nil {
+		t.Fatalf("Error indexing documents: %v", err)
+	}
+
+	_, args := parseArgs([]string{"search", "--query=open", "--network=mla"})
+	output := captureOutput(t, func() { cmdSearch(args) })
+	if !strings.Contains(output, "Found 1 documents") || !strings.Contains(output, "Open Access") {
+		t.Errorf("Expected the mla document only, got %q", output)
+	}
+}
+
+func TestCmdStatus(t *testing.T) {
+	backend := useMemoryBackend(t)
+	_, err := backend.IndexDocument(context.Background(), types.Document{Title: "Searching Openly"})
+	if err != nil {
+		t.Fatalf("Error indexing document: %v", err)
+	}
+
+	output := captureOutput(t, func() { cmdStatus(ParsedArgs{}) })
+	if !strings.Contains(output, "Number of Documents: 1") {
+		t.Errorf("Expected document count in output, got %q", output)
+	}
+}
+
+func TestCmdToken(t *testing.T) {
+	keysFile := filepath.Join(t.TempDir(), "keys.json")
+	t.Setenv("CC_API_KEYS_FILE", keysFile)
+
+	commandName, args := parseArgs([]string{"token", "create", "hc", "--network-nodes=hc", "--permissions=write,delete_node", "--expires=2160h"})
+	if commandName != "token create" {
+		t.Fatalf("Expected token create command, got %q", commandName)
+	}
+	output := captureOutput(t, func() { cmdTokenCreate(args) })
+	_, token, found := strings.Cut(output, "Token: ")
+	if !found {
+		t.Fatalf("Expected token in output, got %q", output)
+	}
+	token, _, _ = strings.Cut(token, "\n")
+
+	keys, err := api.LoadKeys(keysFile)
+	if err != nil || len(keys) != 1 {
+		t.Fatalf("Expected 1 key, got %v (%v)", keys, err)
+	}
+	if !keys[0].Matches(token) || !keys[0].HasPermission(api.PermissionDeleteNode) || keys[0].ExpiresAt == nil {
+		t.Errorf("Expected an expiring delete_node key matching the printed token, got %+v", keys[0])
+	}
+
+	_, args = parseArgs([]string{"token", "list"})
+	output = captureOutput(t, func() { cmdTokenList(args) })
+	if !strings.Contains(output, "hc") || !strings.Contains(output, keys[0].Prefix) || strings.Contains(output, token) {
+		t.Errorf("Expected key name and prefix but not the token in output, got %q", output)
+	}
+}
+
+func TestParseExpiry(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value    string
+		expected time.Time
+	}{
+		{"2024-06-30", time.Date(2024, 6, 30, 0, 0, 0, 0, time.UTC)},
+		{"2024-06-30T12:00:00Z", time.Date(2024, 6, 30, 12, 0, 0, 0, time.UTC)},
+		{"48h", time.Date(2024, 1, 3, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		expires, err := parseExpiry(tt.value, now)
+		if err != nil || !expires.Equal(tt.expected) {
+			t.Errorf("%s: expected %v, got %v (%v)", tt.value, tt.expected, expires, err)
+		}
+	}
+	if _, err := parseExpiry("next week", now); err == nil {
+		t.Error("Expected error for an invalid expiry, got nil")
+	}
+}
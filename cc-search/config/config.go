@@ -2,6 +2,7 @@ package config
 
 import (
 	"reflect"
+	"time"
 
 	"github.com/spf13/viper"
 
@@ -46,10 +47,27 @@ func GetConfig() types.Config {
 		fieldValue := confValue.Field(i)
 
 		var value interface{}
-		if tag, ok := field.Tag.Lookup("mapstructure"); ok {
+		tag, ok := field.Tag.Lookup("mapstructure")
+		if ok {
 			value = config.Get(tag)
 		}
 
+		// Values from the environment are always strings, so durations, bools
+		// and numbers are parsed rather than converted. Durations use Go syntax,
+		// eg. "30s".
+		if value != nil {
+			switch {
+			case fieldValue.Type() == reflect.TypeOf(time.Duration(0)):
+				value = config.GetDuration(tag)
+			case fieldValue.Kind() == reflect.Bool:
+				value = config.GetBool(tag)
+			case fieldValue.Kind() == reflect.Int:
+				value = config.GetInt(tag)
+			case fieldValue.Kind() == reflect.Float64:
+				value = config.GetFloat64(tag)
+			}
+		}
+
 		// Only set the value if it's not nil and the types are compatible
 		if value != nil {
 			valueReflect := reflect.ValueOf(value)
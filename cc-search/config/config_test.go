@@ -3,6 +3,7 @@ package config
 import (
 	"os"
 	"testing"
+	"time"
 )
 
 func TestInit(t *testing.T) {
@@ -39,3 +40,26 @@ func TestEnvConfig(t *testing.T) {
 		t.Errorf("Expected test12345, got %s", config.User)
 	}
 }
+
+func TestEnvConfigParsedTypes(t *testing.T) {
+	err := Init()
+	if err != nil {
+		t.Errorf("Error initializing config: %v", err)
+	}
+	os.Setenv("CC_OS_TLS_INSECURE_SKIP_VERIFY", "true")
+	os.Setenv("CC_OS_RESPONSE_TIMEOUT", "45s")
+	os.Setenv("CC_RECENCY_WEIGHT", "1.5")
+	defer os.Unsetenv("CC_OS_TLS_INSECURE_SKIP_VERIFY")
+	defer os.Unsetenv("CC_OS_RESPONSE_TIMEOUT")
+	defer os.Unsetenv("CC_RECENCY_WEIGHT")
+	config := GetConfig()
+	if !config.TLSInsecureSkipVerify {
+		t.Error("Expected TLSInsecureSkipVerify to be true, got false")
+	}
+	if config.ResponseTimeout != 45*time.Second {
+		t.Errorf("Expected 45s, got %v", config.ResponseTimeout)
+	}
+	if config.RecencyWeight != 1.5 {
+		t.Errorf("Expected 1.5, got %v", config.RecencyWeight)
+	}
+}
@@ -2,6 +2,7 @@ package e2e_tests
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -47,8 +48,50 @@ func TestGetIndex(t *testing.T) {
 	if err != nil {
 		t.Fatalf("Error decoding response: %v", err)
 	}
-	assert.Contains(t, responseIndex, "dev-search")
-	assert.NotContains(t, responseIndex, "foo")
+	// The index info is keyed by the physical index behind the alias.
+	assert.Equal(t, 1, len(responseIndex))
+	for _, indexInfo := range responseIndex {
+		aliases := indexInfo.(map[string]interface{})["aliases"]
+		assert.Contains(t, aliases, "dev-search")
+		assert.NotContains(t, aliases, "foo")
+		assert.Contains(t, indexInfo, "mapping_drift")
+	}
+}
+
+func TestReindex(t *testing.T) {
+	conf := config.GetConfig()
+	router := setupTestRouter()
+	resetIndex()
+	data := getTestFileReader("small_test_doc_collection.json")
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/v1/documents/bulk", data)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", conf.APIKey))
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+	// Pause to allow indexing to complete
+	time.Sleep(1 * time.Second)
+	req, _ = http.NewRequest("POST", "/v1/index/reindex", nil)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", conf.AdminAPIKey))
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+	var result types.ReindexResult
+	err := json.NewDecoder(w.Body).Decode(&result)
+	if err != nil {
+		t.Fatalf("Error decoding reindex result: %v", err)
+	}
+	assert.Equal(t, int64(20), result.Documents)
+	assert.NotContains(t, result.PreviousIndices, result.NewIndex)
+	req, _ = http.NewRequest("GET", "/v1/search?network_node=up", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, 200, w.Code)
+	var response types.SearchResponse
+	err = json.NewDecoder(w.Body).Decode(&response)
+	if err != nil {
+		t.Fatalf("Error decoding search response: %v", err)
+	}
+	assert.Equal(t, 3, len(response.Hits))
 }
 
 func TestResetIndex(t *testing.T) {
@@ -114,7 +157,7 @@ func TestUpdateDocument(t *testing.T) {
 	conf := config.GetConfig()
 	searcher := search.GetSearcher(conf)
 	newDocument := getSingleTestDocument("single_test_doc.json")
-	indexedDocument, err := search.IndexDocument(searcher, newDocument)
+	indexedDocument, err := search.IndexDocument(context.Background(), searcher, newDocument)
 	if err != nil {
 		t.Fatalf("Error indexing document: %v", err)
 	}
@@ -137,7 +180,7 @@ func TestUpdateDocument(t *testing.T) {
 
 	assert.Equal(t, 200, w.Code)
 
-	updatedDocument, err := search.GetDocument(searcher, indexedDocument.ID)
+	updatedDocument, err := search.GetDocument(context.Background(), searcher, indexedDocument.ID)
 	if err != nil {
 		t.Fatalf("Error getting document: %v", err)
 	}
@@ -153,7 +196,7 @@ func TestGetDocument(t *testing.T) {
 	conf := config.GetConfig()
 	searcher := search.GetSearcher(conf)
 	newDocument := getSingleTestDocument("single_test_doc.json")
-	indexedDocument, err := search.IndexDocument(searcher, newDocument)
+	indexedDocument, err := search.IndexDocument(context.Background(), searcher, newDocument)
 	if err != nil {
 		t.Fatalf("Error indexing document: %v", err)
 	}
@@ -194,7 +237,7 @@ func TestGetDocumentWithFilteredFields(t *testing.T) {
 	conf := config.GetConfig()
 	searcher := search.GetSearcher(conf)
 	newDocument := getSingleTestDocument("single_test_doc.json")
-	indexedDocument, err := search.IndexDocument(searcher, newDocument)
+	indexedDocument, err := search.IndexDocument(context.Background(), searcher, newDocument)
 	if err != nil {
 		t.Fatalf("Error indexing document: %v", err)
 	}
@@ -227,7 +270,7 @@ func TestDeleteDocument(t *testing.T) {
 	conf := config.GetConfig()
 	searcher := search.GetSearcher(conf)
 	newDocument := getSingleTestDocument("single_test_doc.json")
-	indexedDocument, err := search.IndexDocument(searcher, newDocument)
+	indexedDocument, err := search.IndexDocument(context.Background(), searcher, newDocument)
 	if err != nil {
 		t.Fatalf("Error indexing document: %v", err)
 	}
@@ -328,7 +371,7 @@ func TestExactMatchSearch(t *testing.T) {
 		t.Fatalf("Expected 2 results, got %d", len(response.Hits))
 	}
 
-	req, _ = http.NewRequest("GET", "/v1/search?title=On+Open+Scholarship", nil)
+	req, _ = http.NewRequest("GET", "/v1/search?title.keyword=On+Open+Scholarship", nil)
 	w = httptest.NewRecorder()
 	router.ServeHTTP(w, req)
 	assert.Equal(t, 200, w.Code)
@@ -1,6 +1,7 @@
 package e2e_tests
 
 import (
+	"context"
 	"encoding/json"
 	"io"
 	"os"
@@ -17,15 +18,15 @@ import (
 func setupTestRouter() *gin.Engine {
 	conf := config.GetConfig()
 	searcher := search.GetSearcher(conf)
-	search.MaybeCreateIndex(&searcher)
-	router := api.SetupRouter(searcher, conf)
+	search.MaybeCreateIndex(context.Background(), &searcher)
+	router := api.SetupRouter(search.NewOpenSearchBackend(searcher), conf)
 	return router
 }
 
 func resetIndex() {
 	conf := config.GetConfig()
 	searcher := search.GetSearcher(conf)
-	search.ResetIndex(&searcher)
+	search.ResetIndex(context.Background(), &searcher)
 }
 
 func getSingleTestDocument(filename string) types.Document {
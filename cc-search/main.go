@@ -1,6 +1,9 @@
 package main
 
 import (
+	"context"
+	"log"
+
 	"github.com/MESH-Research/commons-connect/cc-search/api"
 	"github.com/MESH-Research/commons-connect/cc-search/config"
 	"github.com/MESH-Research/commons-connect/cc-search/search"
@@ -8,8 +11,11 @@ import (
 
 func main() {
 	conf := config.GetConfig()
-	searcher := search.GetSearcher(conf)
-	search.MaybeCreateIndex(&searcher)
-	router := api.SetupRouter(searcher, conf)
+	backend := search.GetBackend(conf)
+	err := backend.MaybeCreateIndex(context.Background())
+	if err != nil {
+		log.Println("Error preparing index: ", err)
+	}
+	router := api.SetupRouter(backend, conf)
 	router.Run(":80")
 }
@@ -0,0 +1,158 @@
+package search
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+
+	opensearchapi "github.com/opensearch-project/opensearch-go/v2/opensearchapi"
+
+	"github.com/MESH-Research/commons-connect/cc-search/types"
+)
+
+// Backend stores and searches documents. The api package and the ccs CLI work
+// against a Backend, so they can run against OpenSearch or, in tests and local
+// development, the in-memory MemoryBackend.
+type Backend interface {
+	IndexDocument(ctx context.Context, document types.Document) (*types.Document, error)
+	UpsertDocument(ctx context.Context, document types.Document) (*types.Document, bool, error)
+	GetDocument(ctx context.Context, id string) (*types.Document, error)
+	DocumentNetworkNodes(ctx context.Context, ids []string) (map[string]string, error)
+	UpdateDocument(ctx context.Context, document types.Document) error
+	DeleteDocument(ctx context.Context, id string) error
+	DeleteNode(ctx context.Context, node string) error
+
+	BulkIndexDocuments(ctx context.Context, documents []types.Document) ([]types.BulkItemResult, error)
+	BulkUpdateDocuments(ctx context.Context, documents []types.Document) ([]types.BulkItemResult, error)
+	BulkUpsertDocuments(ctx context.Context, documents []types.Document) ([]types.BulkItemResult, error)
+	BulkDeleteDocuments(ctx context.Context, ids []string) ([]types.BulkItemResult, error)
+
+	Search(ctx context.Context, params types.SearchParams) (types.SearchResponse, error)
+	TypeAheadSearch(ctx context.Context, query string, viewer *types.Viewer) ([]types.Document, error)
+	RelatedDocuments(ctx context.Context, id string, params types.SearchParams) (types.SearchResponse, error)
+
+	MaybeCreateIndex(ctx context.Context) error
+	ResetIndex(ctx context.Context) error
+	Reindex(ctx context.Context) (*types.ReindexResult, error)
+	GetIndexInfo(ctx context.Context) (map[string]interface{}, error)
+	CountDocuments(ctx context.Context) (int64, error)
+}
+
+// Returns the backend selected by conf.Backend: `memory` for an empty
+// in-memory index, otherwise OpenSearch.
+func GetBackend(conf types.Config) Backend {
+	if conf.Backend == `memory` {
+		return NewMemoryBackend(conf.IndexName)
+	}
+	return NewOpenSearchBackend(GetSearcher(conf))
+}
+
+// OpenSearchBackend is the Backend for an OpenSearch cluster.
+type OpenSearchBackend struct {
+	Searcher types.Searcher
+}
+
+func NewOpenSearchBackend(searcher types.Searcher) *OpenSearchBackend {
+	return &OpenSearchBackend{Searcher: searcher}
+}
+
+func (backend *OpenSearchBackend) IndexDocument(ctx context.Context, document types.Document) (*types.Document, error) {
+	return IndexDocument(ctx, backend.Searcher, document)
+}
+
+func (backend *OpenSearchBackend) UpsertDocument(ctx context.Context, document types.Document) (*types.Document, bool, error) {
+	return UpsertDocument(ctx, backend.Searcher, document)
+}
+
+func (backend *OpenSearchBackend) GetDocument(ctx context.Context, id string) (*types.Document, error) {
+	return GetDocument(ctx, backend.Searcher, id)
+}
+
+func (backend *OpenSearchBackend) DocumentNetworkNodes(ctx context.Context, ids []string) (map[string]string, error) {
+	return DocumentNetworkNodes(ctx, backend.Searcher, ids)
+}
+
+func (backend *OpenSearchBackend) UpdateDocument(ctx context.Context, document types.Document) error {
+	return UpdateDocument(ctx, backend.Searcher, document)
+}
+
+func (backend *OpenSearchBackend) DeleteDocument(ctx context.Context, id string) error {
+	return DeleteDocument(ctx, backend.Searcher, id)
+}
+
+func (backend *OpenSearchBackend) DeleteNode(ctx context.Context, node string) error {
+	return DeleteNode(ctx, backend.Searcher, node)
+}
+
+func (backend *OpenSearchBackend) BulkIndexDocuments(ctx context.Context, documents []types.Document) ([]types.BulkItemResult, error) {
+	return BulkIndexDocuments(ctx, backend.Searcher, documents)
+}
+
+func (backend *OpenSearchBackend) BulkUpdateDocuments(ctx context.Context, documents []types.Document) ([]types.BulkItemResult, error) {
+	return BulkUpdateDocuments(ctx, backend.Searcher, documents)
+}
+
+func (backend *OpenSearchBackend) BulkUpsertDocuments(ctx context.Context, documents []types.Document) ([]types.BulkItemResult, error) {
+	return BulkUpsertDocuments(ctx, backend.Searcher, documents)
+}
+
+func (backend *OpenSearchBackend) BulkDeleteDocuments(ctx context.Context, ids []string) ([]types.BulkItemResult, error) {
+	return BulkDeleteDocuments(ctx, backend.Searcher, ids)
+}
+
+func (backend *OpenSearchBackend) Search(ctx context.Context, params types.SearchParams) (types.SearchResponse, error) {
+	return Search(ctx, backend.Searcher, params)
+}
+
+func (backend *OpenSearchBackend) TypeAheadSearch(ctx context.Context, query string, viewer *types.Viewer) ([]types.Document, error) {
+	return TypeAheadSearch(ctx, backend.Searcher, query, viewer)
+}
+
+func (backend *OpenSearchBackend) RelatedDocuments(ctx context.Context, id string, params types.SearchParams) (types.SearchResponse, error) {
+	return RelatedDocuments(ctx, backend.Searcher, id, params)
+}
+
+func (backend *OpenSearchBackend) MaybeCreateIndex(ctx context.Context) error {
+	return MaybeCreateIndex(ctx, &backend.Searcher)
+}
+
+func (backend *OpenSearchBackend) ResetIndex(ctx context.Context) error {
+	return ResetIndex(ctx, &backend.Searcher)
+}
+
+func (backend *OpenSearchBackend) Reindex(ctx context.Context) (*types.ReindexResult, error) {
+	return Reindex(ctx, &backend.Searcher)
+}
+
+func (backend *OpenSearchBackend) GetIndexInfo(ctx context.Context) (map[string]interface{}, error) {
+	return GetIndexInfo(ctx, &backend.Searcher)
+}
+
+func (backend *OpenSearchBackend) CountDocuments(ctx context.Context) (int64, error) {
+	return CountDocuments(ctx, backend.Searcher)
+}
+
+// Returns the number of documents in the index.
+func CountDocuments(ctx context.Context, searcher types.Searcher) (int64, error) {
+	req := opensearchapi.CountRequest{
+		Index: []string{searcher.IndexName},
+	}
+	response, err := req.Do(ctx, searcher.Client)
+	if err != nil {
+		return 0, errors.New(`error counting documents: ` + err.Error())
+	}
+	defer response.Body.Close()
+	if response.StatusCode != 200 {
+		bodyBytes, _ := io.ReadAll(response.Body)
+		return 0, errors.New(string(bodyBytes))
+	}
+	var responseJSON struct {
+		Count int64 `json:"count"`
+	}
+	err = json.NewDecoder(response.Body).Decode(&responseJSON)
+	if err != nil {
+		return 0, errors.New(`error decoding response: ` + err.Error())
+	}
+	return responseJSON.Count, nil
+}
@@ -1,23 +1,47 @@
 package search
 
 import (
+	"context"
 	"crypto/tls"
+	"crypto/x509"
 	"errors"
+	"fmt"
 	"net"
 	"net/http"
+	"os"
 	"time"
 
-	"github.com/MESH-Research/commons-connect/cc-search/types"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
 	osg "github.com/opensearch-project/opensearch-go/v2"
+	"github.com/opensearch-project/opensearch-go/v2/signer/awsv2"
+
+	"github.com/MESH-Research/commons-connect/cc-search/types"
+)
+
+// Service name used to sign requests to Amazon OpenSearch Service domains.
+// Serverless collections use 'aoss' instead.
+const defaultAWSService = `es`
+
+// Transport defaults used when the configuration does not set a value.
+const (
+	defaultDialTimeout     = 5 * time.Second
+	defaultResponseTimeout = 30 * time.Second
+	defaultTLSMinVersion   = tls.VersionTLS12
 )
 
+var tlsVersions = map[string]uint16{
+	`1.0`: tls.VersionTLS10,
+	`1.1`: tls.VersionTLS11,
+	`1.2`: tls.VersionTLS12,
+	`1.3`: tls.VersionTLS13,
+}
+
 func GetSearcher(conf types.Config) types.Searcher {
-	client, err := GetClient(
-		conf.SearchEndpoint,
-		conf.User,
-		conf.Password,
-		conf.ClientMode,
-	)
+	client, err := GetClient(conf)
 	if err != nil {
 		panic(err)
 	}
@@ -27,42 +51,184 @@ func GetSearcher(conf types.Config) types.Searcher {
 	}
 }
 
-func GetClient(clientURL string, user string, pass string, clientMode string) (*osg.Client, error) {
-	if clientURL == `` {
+// Returns a client for the endpoint and client mode in conf. Client modes are:
+//   - noauth: no authentication
+//   - aws: requests are signed with AWS SigV4
+//   - aws-role: requests are signed with AWS SigV4 after assuming conf.AWSRoleARN
+//   - anything else: HTTP basic auth with conf.User and conf.Password
+func GetClient(conf types.Config) (*osg.Client, error) {
+	if conf.SearchEndpoint == `` {
 		return nil, errors.New(`clientURL is required`)
 	}
-	if clientMode == `noauth` {
-		return GetClientNoAuth(clientURL)
+	transport, err := NewTransport(conf)
+	if err != nil {
+		return nil, err
 	}
-	if (user == ``) || (pass == ``) {
+	switch conf.ClientMode {
+	case `noauth`:
+		return GetClientNoAuth(conf.SearchEndpoint, transport)
+	case `aws`, `aws-role`:
+		awsCfg, err := getAWSConfig(conf)
+		if err != nil {
+			return nil, err
+		}
+		service := conf.AWSService
+		if service == `` {
+			service = defaultAWSService
+		}
+		return GetClientAWS(conf.SearchEndpoint, awsCfg, service, transport)
+	}
+	if (conf.User == ``) || (conf.Password == ``) {
 		return nil, errors.New(`user and pass are required for basic auth mode`)
 	}
-	return GetClientUserPass(clientURL, user, pass)
+	return GetClientUserPass(conf.SearchEndpoint, conf.User, conf.Password, transport)
+}
+
+// Returns the transport for connections to OpenSearch, with the CA bundle,
+// client certificate, minimum TLS version and timeouts set in conf.
+func NewTransport(conf types.Config) (*http.Transport, error) {
+	tlsConfig := &tls.Config{
+		MinVersion:         defaultTLSMinVersion,
+		InsecureSkipVerify: conf.TLSInsecureSkipVerify,
+	}
+	if conf.TLSMinVersion != `` {
+		version, ok := tlsVersions[conf.TLSMinVersion]
+		if !ok {
+			return nil, fmt.Errorf(`invalid minimum TLS version: %s`, conf.TLSMinVersion)
+		}
+		tlsConfig.MinVersion = version
+	}
+	if conf.TLSCAFile != `` {
+		caPEM, err := os.ReadFile(conf.TLSCAFile)
+		if err != nil {
+			return nil, errors.New(`error reading CA bundle: ` + err.Error())
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caPEM) {
+			return nil, errors.New(`no certificates found in CA bundle ` + conf.TLSCAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if conf.TLSCertFile != `` || conf.TLSKeyFile != `` {
+		if conf.TLSCertFile == `` || conf.TLSKeyFile == `` {
+			return nil, errors.New(`both client certificate and key are required for mTLS`)
+		}
+		cert, err := tls.LoadX509KeyPair(conf.TLSCertFile, conf.TLSKeyFile)
+		if err != nil {
+			return nil, errors.New(`error loading client certificate: ` + err.Error())
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	dialTimeout := conf.DialTimeout
+	if dialTimeout <= 0 {
+		dialTimeout = defaultDialTimeout
+	}
+	responseTimeout := conf.ResponseTimeout
+	if responseTimeout <= 0 {
+		responseTimeout = defaultResponseTimeout
+	}
+	return &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		MaxIdleConnsPerHost:   10,
+		ResponseHeaderTimeout: responseTimeout,
+		DialContext:           (&net.Dialer{Timeout: dialTimeout}).DialContext,
+		TLSClientConfig:       tlsConfig,
+	}, nil
 }
 
-func GetClientNoAuth(clientURL string) (*osg.Client, error) {
+// Returns a client without authentication. A nil transport uses the
+// NewTransport defaults.
+func GetClientNoAuth(clientURL string, transport http.RoundTripper) (*osg.Client, error) {
+	transport, err := defaultTransport(transport)
+	if err != nil {
+		return nil, err
+	}
 	client, err := osg.NewClient(osg.Config{
-		Transport: &http.Transport{
-			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-		},
+		Transport: transport,
 		Addresses: []string{clientURL},
 	})
 	return client, err
 }
 
-func GetClientUserPass(clientURL string, user string, pass string) (*osg.Client, error) {
+// Returns a client using HTTP basic auth. A nil transport uses the
+// NewTransport defaults.
+func GetClientUserPass(clientURL string, user string, pass string, transport http.RoundTripper) (*osg.Client, error) {
+	transport, err := defaultTransport(transport)
+	if err != nil {
+		return nil, err
+	}
 	client, err := osg.NewClient(osg.Config{
-		Transport: &http.Transport{
-			MaxIdleConnsPerHost:   10,
-			ResponseHeaderTimeout: time.Second,
-			DialContext:           (&net.Dialer{Timeout: time.Second}).DialContext,
-			TLSClientConfig: &tls.Config{
-				MinVersion: tls.VersionTLS11,
-			},
-		},
+		Transport: transport,
 		Addresses: []string{clientURL},
 		Username:  user,
 		Password:  pass,
 	})
 	return client, err
 }
+
+// Returns a client that signs requests with AWS SigV4 using the region and
+// credentials in awsCfg. Service is the name requests are signed for. A nil
+// transport uses the NewTransport defaults.
+func GetClientAWS(clientURL string, awsCfg aws.Config, service string, transport http.RoundTripper) (*osg.Client, error) {
+	signer, err := awsv2.NewSignerWithService(awsCfg, service)
+	if err != nil {
+		return nil, err
+	}
+	transport, err = defaultTransport(transport)
+	if err != nil {
+		return nil, err
+	}
+	client, err := osg.NewClient(osg.Config{
+		Transport: transport,
+		Addresses: []string{clientURL},
+		Signer:    signer,
+	})
+	return client, err
+}
+
+func defaultTransport(transport http.RoundTripper) (http.RoundTripper, error) {
+	if transport != nil {
+		return transport, nil
+	}
+	return NewTransport(types.Config{})
+}
+
+// Loads AWS region and credentials. Values in conf take precedence over the
+// default AWS sources (environment, shared config files, instance/task role).
+// In aws-role mode the resulting credentials are used to assume
+// conf.AWSRoleARN.
+func getAWSConfig(conf types.Config) (aws.Config, error) {
+	options := []func(*awsconfig.LoadOptions) error{}
+	if conf.AWSRegion != `` {
+		options = append(options, awsconfig.WithRegion(conf.AWSRegion))
+	}
+	if conf.AWSAccessKeyID != `` || conf.AWSSecretAccessKey != `` {
+		if conf.AWSAccessKeyID == `` || conf.AWSSecretAccessKey == `` {
+			return aws.Config{}, errors.New(`both AWS access key ID and secret access key are required`)
+		}
+		options = append(options, awsconfig.WithCredentialsProvider(
+			credentials.NewStaticCredentialsProvider(
+				conf.AWSAccessKeyID,
+				conf.AWSSecretAccessKey,
+				conf.AWSSessionToken,
+			),
+		))
+	}
+	awsCfg, err := awsconfig.LoadDefaultConfig(context.Background(), options...)
+	if err != nil {
+		return aws.Config{}, errors.New(`error loading AWS config: ` + err.Error())
+	}
+	if awsCfg.Region == `` {
+		return aws.Config{}, errors.New(`AWS region is required for aws client modes`)
+	}
+	if conf.ClientMode == `aws-role` {
+		if conf.AWSRoleARN == `` {
+			return aws.Config{}, errors.New(`AWS role ARN is required for aws-role client mode`)
+		}
+		awsCfg.Credentials = aws.NewCredentialsCache(
+			stscreds.NewAssumeRoleProvider(sts.NewFromConfig(awsCfg), conf.AWSRoleARN),
+		)
+	}
+	return awsCfg, nil
+}
@@ -0,0 +1,281 @@
+package search
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	opensearchapi "github.com/opensearch-project/opensearch-go/v2/opensearchapi"
+
+	"github.com/MESH-Research/commons-connect/cc-search/types"
+)
+
+const (
+	stubAccessKeyID     = "AKIDEXAMPLE"
+	stubSecretAccessKey = "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"
+	stubRegion          = "us-east-1"
+)
+
+// sigV4Stub is a stand-in for an Amazon OpenSearch Service endpoint. It
+// re-signs each request with the known credentials and rejects requests whose
+// signature does not match.
+func sigV4Stub(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := r.Header.Get("Authorization")
+		if !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 ") {
+			http.Error(w, `{"message":"missing signature"}`, http.StatusForbidden)
+			return
+		}
+		signedAt, err := time.Parse("20060102T150405Z", r.Header.Get("X-Amz-Date"))
+		if err != nil {
+			http.Error(w, `{"message":"invalid date"}`, http.StatusForbidden)
+			return
+		}
+		signedHeaders := ""
+		for _, part := range strings.Split(strings.TrimPrefix(auth, "AWS4-HMAC-SHA256 "), ", ") {
+			if strings.HasPrefix(part, "SignedHeaders=") {
+				signedHeaders = strings.TrimPrefix(part, "SignedHeaders=")
+			}
+		}
+
+		// Rebuild the request from the signed headers only, since the transport
+		// adds headers such as Accept-Encoding after signing.
+		check, _ := http.NewRequest(r.Method, "http://"+r.Host+r.URL.RequestURI(), nil)
+		for _, header := range strings.Split(signedHeaders, ";") {
+			if header == "host" {
+				continue
+			}
+			check.Header.Set(header, r.Header.Get(header))
+		}
+		check.Header.Del("Authorization")
+		check.ContentLength = r.ContentLength
+		err = v4.NewSigner().SignHTTP(
+			context.Background(),
+			aws.Credentials{AccessKeyID: stubAccessKeyID, SecretAccessKey: stubSecretAccessKey},
+			check,
+			r.Header.Get("X-Amz-Content-Sha256"),
+			defaultAWSService,
+			stubRegion,
+			signedAt,
+		)
+		if err != nil {
+			t.Fatalf("Error signing request: %v", err)
+		}
+		if check.Header.Get("Authorization") != auth {
+			http.Error(w, `{"message":"signature does not match"}`, http.StatusForbidden)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"acknowledged":true}`))
+	}))
+}
+
+func TestGetClientAWSSignsRequests(t *testing.T) {
+	server := sigV4Stub(t)
+	defer server.Close()
+
+	tests := []struct {
+		name   string
+		secret string
+		status int
+	}{
+		{"valid credentials", stubSecretAccessKey, http.StatusOK},
+		{"wrong secret", "not-the-secret", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		client, err := GetClient(types.Config{
+			SearchEndpoint:     server.URL,
+			ClientMode:         "aws",
+			AWSRegion:          stubRegion,
+			AWSAccessKeyID:     stubAccessKeyID,
+			AWSSecretAccessKey: tt.secret,
+		})
+		if err != nil {
+			t.Fatalf("%s: error getting client: %v", tt.name, err)
+		}
+		req := opensearchapi.SearchRequest{
+			Index: []string{"test"},
+			Body:  basicSearchQuery("signed").reader(),
+		}
+		response, err := req.Do(context.Background(), client)
+		if err != nil {
+			t.Fatalf("%s: error sending request: %v", tt.name, err)
+		}
+		response.Body.Close()
+		if response.StatusCode != tt.status {
+			t.Errorf("%s: expected status %d, got %d", tt.name, tt.status, response.StatusCode)
+		}
+	}
+}
+
+func TestGetClientAWSConfigErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		conf types.Config
+	}{
+		{
+			"role mode without role",
+			types.Config{
+				SearchEndpoint:     "http://localhost:9200",
+				ClientMode:         "aws-role",
+				AWSRegion:          stubRegion,
+				AWSAccessKeyID:     stubAccessKeyID,
+				AWSSecretAccessKey: stubSecretAccessKey,
+			},
+		},
+		{
+			"access key without secret",
+			types.Config{
+				SearchEndpoint: "http://localhost:9200",
+				ClientMode:     "aws",
+				AWSRegion:      stubRegion,
+				AWSAccessKeyID: stubAccessKeyID,
+			},
+		},
+	}
+	for _, tt := range tests {
+		_, err := GetClient(tt.conf)
+		if err == nil {
+			t.Errorf("%s: expected error, got nil", tt.name)
+		}
+	}
+}
+
+// writePEM writes a PEM block of blockType to a file in dir and returns its path.
+func writePEM(t *testing.T, dir string, name string, blockType string, der []byte) string {
+	path := filepath.Join(dir, name)
+	err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0600)
+	if err != nil {
+		t.Fatalf("Error writing %s: %v", name, err)
+	}
+	return path
+}
+
+// writeClientCert writes a self-signed client certificate and key to dir.
+func writeClientCert(t *testing.T, dir string) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Error generating key: %v", err)
+	}
+	template := x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "cc-search"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	certDER, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Error creating certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("Error marshalling key: %v", err)
+	}
+	return writePEM(t, dir, "client.pem", "CERTIFICATE", certDER),
+		writePEM(t, dir, "client-key.pem", "EC PRIVATE KEY", keyDER)
+}
+
+func TestNewTransportTLS(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{}`))
+	}))
+	server.Config.ErrorLog = log.New(io.Discard, "", 0)
+	server.TLS = &tls.Config{
+		ClientAuth: tls.RequireAnyClientCert,
+		MaxVersion: tls.VersionTLS12,
+	}
+	server.StartTLS()
+	defer server.Close()
+
+	dir := t.TempDir()
+	caFile := writePEM(t, dir, "ca.pem", "CERTIFICATE", server.Certificate().Raw)
+	certFile, keyFile := writeClientCert(t, dir)
+
+	tests := []struct {
+		name string
+		conf types.Config
+		ok   bool
+	}{
+		{"custom CA and client certificate", types.Config{TLSCAFile: caFile, TLSCertFile: certFile, TLSKeyFile: keyFile}, true},
+		{"unknown CA", types.Config{TLSCertFile: certFile, TLSKeyFile: keyFile}, false},
+		{"missing client certificate", types.Config{TLSCAFile: caFile}, false},
+		{"minimum version above server", types.Config{TLSCAFile: caFile, TLSCertFile: certFile, TLSKeyFile: keyFile, TLSMinVersion: "1.3"}, false},
+	}
+	for _, tt := range tests {
+		tt.conf.SearchEndpoint = server.URL
+		tt.conf.ClientMode = "noauth"
+		client, err := GetClient(tt.conf)
+		if err != nil {
+			t.Fatalf("%s: error getting client: %v", tt.name, err)
+		}
+		response, err := opensearchapi.InfoRequest{}.Do(context.Background(), client)
+		if err == nil {
+			response.Body.Close()
+		}
+		if tt.ok && err != nil {
+			t.Errorf("%s: expected no error, got %v", tt.name, err)
+		}
+		if !tt.ok && err == nil {
+			t.Errorf("%s: expected error, got nil", tt.name)
+		}
+	}
+}
+
+func TestNewTransportErrors(t *testing.T) {
+	dir := t.TempDir()
+	certFile, _ := writeClientCert(t, dir)
+	tests := []struct {
+		name string
+		conf types.Config
+	}{
+		{"invalid minimum version", types.Config{TLSMinVersion: "1.4"}},
+		{"missing CA bundle", types.Config{TLSCAFile: filepath.Join(dir, "missing.pem")}},
+		{"CA bundle without certificates", types.Config{TLSCAFile: writePEM(t, dir, "empty.pem", "NOTHING", []byte{})}},
+		{"certificate without key", types.Config{TLSCertFile: certFile}},
+	}
+	for _, tt := range tests {
+		_, err := NewTransport(tt.conf)
+		if err == nil {
+			t.Errorf("%s: expected error, got nil", tt.name)
+		}
+	}
+}
+
+func TestNewTransportTimeouts(t *testing.T) {
+	transport, err := NewTransport(types.Config{ResponseTimeout: 2 * time.Minute})
+	if err != nil {
+		t.Fatalf("Error creating transport: %v", err)
+	}
+	if transport.ResponseHeaderTimeout != 2*time.Minute {
+		t.Errorf("Expected 2m response timeout, got %v", transport.ResponseHeaderTimeout)
+	}
+	transport, err = NewTransport(types.Config{})
+	if err != nil {
+		t.Fatalf("Error creating transport: %v", err)
+	}
+	if transport.ResponseHeaderTimeout != defaultResponseTimeout {
+		t.Errorf("Expected default response timeout, got %v", transport.ResponseHeaderTimeout)
+	}
+	if transport.TLSClientConfig.InsecureSkipVerify {
+		t.Error("Expected certificate verification by default")
+	}
+}
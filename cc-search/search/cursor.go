@@ -0,0 +1,157 @@
+package search
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"time"
+
+	opensearchapi "github.com/opensearch-project/opensearch-go/v2/opensearchapi"
+
+	"github.com/MESH-Research/commons-connect/cc-search/types"
+)
+
+// CursorStart is passed as the cursor to begin walking a result set with
+// search_after pagination.
+const CursorStart = "*"
+
+// Fields used to break ties between hits with equal sort values, so that every
+// hit has a unique position in the sort order. Searches against a point in
+// time break ties on each hit's shard and position within it, other searches
+// on the copy of the document ID. Sorting on _id itself loads every ID into
+// fielddata.
+const (
+	tieBreakerField            = documentIDField
+	pointInTimeTieBreakerField = "_shard_doc"
+)
+
+// How long OpenSearch keeps a point in time alive between requests.
+const pointInTimeKeepAlive = 5 * time.Minute
+
+var ErrInvalidCursor = errors.New(`invalid cursor`)
+
+// cursor is the decoded form of the opaque cursor token returned to clients.
+// It records the sort the result set was walked with so that a cursor cannot
+// be resumed under a different sort.
+type cursor struct {
+	SearchAfter   []json.RawMessage `json:"a"`
+	Sort          []types.SortKey   `json:"s,omitempty"`
+	PointInTimeID string            `json:"p,omitempty"`
+}
+
+type pointInTime struct {
+	ID        string `json:"id"`
+	KeepAlive string `json:"keep_alive"`
+}
+
+func encodeCursor(c cursor) string {
+	cursorJSON, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(cursorJSON)
+}
+
+func decodeCursor(token string) (*cursor, error) {
+	cursorJSON, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, fmt.Errorf(`%w: %s`, ErrInvalidCursor, err.Error())
+	}
+	var c cursor
+	err = json.Unmarshal(cursorJSON, &c)
+	if err != nil {
+		return nil, fmt.Errorf(`%w: %s`, ErrInvalidCursor, err.Error())
+	}
+	if len(c.SearchAfter) == 0 {
+		return nil, fmt.Errorf(`%w: missing search position`, ErrInvalidCursor)
+	}
+	// The sort is sent to OpenSearch as is, so it is validated as a sort
+	// parameter would be.
+	for i, key := range c.Sort {
+		c.Sort[i], err = NewSortKey(key.Field, key.Direction)
+		if err != nil {
+			return nil, fmt.Errorf(`%w: %s`, ErrInvalidCursor, err.Error())
+		}
+	}
+	return &c, nil
+}
+
+// applyCursor resolves the cursor in params into the search_after position,
+// sort and point in time to search with. For a new cursor a point in time is
+// opened if one was requested.
+func applyCursor(ctx context.Context, searcher types.Searcher, params *types.SearchParams) error {
+	if params.Cursor == CursorStart {
+		if !params.PointInTime {
+			return nil
+		}
+		pitID, err := createPointInTime(ctx, searcher)
+		if err != nil {
+			return err
+		}
+		params.PointInTimeID = pitID
+		return nil
+	}
+	c, err := decodeCursor(params.Cursor)
+	if err != nil {
+		return err
+	}
+	if params.Sort != nil && !slices.Equal(params.Sort, c.Sort) {
+		return fmt.Errorf(`%w: cursor was created with a different sort`, ErrInvalidCursor)
+	}
+	params.Sort = c.Sort
+	params.SearchAfter = c.SearchAfter
+	params.PointInTimeID = c.PointInTimeID
+	return nil
+}
+
+// nextCursor returns the cursor for the page following searchResult, or an
+// empty string if searchResult is the last page. The point in time, if any, is
+// closed once the last page has been reached.
+func nextCursor(ctx context.Context, searcher types.Searcher, searchResult *types.SearchResult, params types.SearchParams, size int) string {
+	pitID := params.PointInTimeID
+	if searchResult.PitID != "" {
+		pitID = searchResult.PitID
+	}
+	hits := searchResult.Hits.Hits
+	if len(hits) == 0 || len(hits) < size {
+		if pitID != "" {
+			deletePointInTime(context.WithoutCancel(ctx), searcher, pitID)
+		}
+		return ""
+	}
+	c := cursor{
+		SearchAfter:   hits[len(hits)-1].Sort,
+		Sort:          params.Sort,
+		PointInTimeID: pitID,
+	}
+	return encodeCursor(c)
+}
+
+func createPointInTime(ctx context.Context, searcher types.Searcher) (string, error) {
+	req := opensearchapi.PointInTimeCreateRequest{
+		Index:     []string{searcher.IndexName},
+		KeepAlive: pointInTimeKeepAlive,
+	}
+	response, pit, err := req.Do(ctx, searcher.Client)
+	if err != nil {
+		return ``, errors.New(`error creating point in time: ` + err.Error())
+	}
+	defer response.Body.Close()
+	if response.StatusCode != 200 || pit == nil {
+		return ``, fmt.Errorf(`error creating point in time: status code %v`, response.StatusCode)
+	}
+	return pit.PitID, nil
+}
+
+func deletePointInTime(ctx context.Context, searcher types.Searcher, pitID string) {
+	req := opensearchapi.PointInTimeDeleteRequest{
+		PitID: []string{pitID},
+	}
+	response, _, err := req.Do(ctx, searcher.Client)
+	if err != nil {
+		log.Println(`Error deleting point in time: `, err)
+		return
+	}
+	response.Body.Close()
+}
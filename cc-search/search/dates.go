@@ -0,0 +1,140 @@
+package search
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/MESH-Research/commons-connect/cc-search/types"
+)
+
+// DefaultDateField is the field that date ranges apply to when no date field
+// is given.
+const DefaultDateField = "publication_date"
+
+// Date fields of the index mappings that date ranges may apply to, sorted.
+var dateFields = mappedFields(func(mapping types.OSFieldMapping) bool {
+	return (mapping.Index == nil || *mapping.Index) && mapping.Type == "date"
+})
+
+// Date math relative to the current time, eg. now-7d or now-1M/M: any number
+// of added or subtracted units, optionally rounded to a unit.
+var dateMathPattern = regexp.MustCompile(`^now((?:[+-][0-9]{1,6}[yMwdhHms])*)(?:/([yMwdhHms]))?$`)
+var dateMathStepPattern = regexp.MustCompile(`([+-])([0-9]+)([yMwdhHms])`)
+
+// Layouts of calendar dates, each covering a year, month or day.
+var calendarDateLayouts = map[string]byte{
+	"2006":       'y',
+	"2006-01":    'M',
+	"2006-01-02": 'd',
+}
+
+// ValidateDateField returns an error unless date ranges can apply to field.
+func ValidateDateField(field string) error {
+	if !slices.Contains(dateFields, field) {
+		return fmt.Errorf(
+			`invalid date field: %s (valid date fields: %s)`,
+			field,
+			strings.Join(dateFields, ", "),
+		)
+	}
+	return nil
+}
+
+// ValidateDate returns an error unless value can bound a date range: a
+// calendar date (2006, 2006-01 or 2006-01-02), an RFC 3339 timestamp, or date
+// math relative to now, eg. now-7d or now-1M/d.
+func ValidateDate(value string) error {
+	_, err := parseDateBound(value, time.Now(), false)
+	return err
+}
+
+// parseDateBound returns the time that a date range bound refers to. Calendar
+// dates and rounded date math cover a period, and roundUp selects the end of
+// the period rather than its start, as OpenSearch does for lte bounds.
+func parseDateBound(value string, now time.Time, roundUp bool) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	for layout, unit := range calendarDateLayouts {
+		if len(layout) != len(value) {
+			continue
+		}
+		if t, err := time.Parse(layout, value); err == nil {
+			return roundDate(t, unit, roundUp), nil
+		}
+	}
+	match := dateMathPattern.FindStringSubmatch(value)
+	if match == nil {
+		return time.Time{}, errors.New(
+			`invalid date: ` + value + ` (use a date such as 2006-01-02, an RFC 3339 timestamp, or date math such as now-7d)`,
+		)
+	}
+	t := now.UTC()
+	for _, step := range dateMathStepPattern.FindAllStringSubmatch(match[1], -1) {
+		n, _ := strconv.Atoi(step[2])
+		if step[1] == `-` {
+			n = -n
+		}
+		t = addDateUnit(t, n, step[3][0])
+	}
+	if match[2] != `` {
+		t = roundDate(t, match[2][0], roundUp)
+	}
+	return t, nil
+}
+
+// roundDate rounds t down to the start of unit, or with roundUp to the last
+// millisecond of unit.
+func roundDate(t time.Time, unit byte, roundUp bool) time.Time {
+	switch unit {
+	case 'y':
+		t = time.Date(t.Year(), 1, 1, 0, 0, 0, 0, t.Location())
+	case 'M':
+		t = time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location())
+	case 'w':
+		t = time.Date(t.Year(), t.Month(), t.Day()-(int(t.Weekday())+6)%7, 0, 0, 0, 0, t.Location())
+	case 'd':
+		t = time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	case 'h', 'H':
+		t = t.Truncate(time.Hour)
+	case 'm':
+		t = t.Truncate(time.Minute)
+	case 's':
+		t = t.Truncate(time.Second)
+	}
+	if roundUp {
+		t = addDateUnit(t, 1, unit).Add(-time.Millisecond)
+	}
+	return t
+}
+
+func addDateUnit(t time.Time, n int, unit byte) time.Time {
+	switch unit {
+	case 'y':
+		return t.AddDate(n, 0, 0)
+	case 'M':
+		return t.AddDate(0, n, 0)
+	case 'w':
+		return t.AddDate(0, 0, 7*n)
+	case 'd':
+		return t.AddDate(0, 0, n)
+	case 'h', 'H':
+		return t.Add(time.Duration(n) * time.Hour)
+	case 'm':
+		return t.Add(time.Duration(n) * time.Minute)
+	}
+	return t.Add(time.Duration(n) * time.Second)
+}
+
+// dateField returns the field that the date range of params applies to.
+func dateField(params types.SearchParams) string {
+	if params.DateField == `` {
+		return DefaultDateField
+	}
+	return params.DateField
+}
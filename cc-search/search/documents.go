@@ -2,10 +2,14 @@ package search
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
+	"reflect"
 	"strings"
 	"time"
 
@@ -27,21 +31,29 @@ type indexDocumentResponse struct {
 	PrimaryTerm int64 `json:"_primary_term"`
 }
 
+// Field of the indexed source that holds a copy of the document's ID. Unlike
+// _id it has doc values, so searches can break ties on it without loading the
+// IDs of every document into fielddata.
+const documentIDField = `_document_id`
+
 // Indexes a new document and returns its ID. IDs have the form 'yQQEYY0B1VMrrWgmZN1j'.
 // This is not for updating existing documents.
-func IndexDocument(searcher types.Searcher, document types.Document) (*types.Document, error) {
+func IndexDocument(ctx context.Context, searcher types.Searcher, document types.Document) (*types.Document, error) {
 	if document.ID != `` {
 		return nil, errors.New(`ID should not be provided for new documents`)
 	}
-	body, err := json.Marshal(document)
+	id := newDocumentID()
+	body, err := indexBody(document, id)
 	if err != nil {
 		return nil, errors.New(`error marshalling document: ` + err.Error())
 	}
 	req := opensearchapi.IndexRequest{
-		Index: searcher.IndexName,
-		Body:  strings.NewReader(string(body)),
+		Index:      searcher.IndexName,
+		DocumentID: id,
+		OpType:     `create`,
+		Body:       strings.NewReader(string(body)),
 	}
-	response, err := req.Do(context.Background(), searcher.Client)
+	response, err := req.Do(ctx, searcher.Client)
 	if err != nil {
 		return nil, errors.New(`error indexing document: ` + err.Error())
 	}
@@ -59,90 +71,268 @@ func IndexDocument(searcher types.Searcher, document types.Document) (*types.Doc
 	return &document, nil
 }
 
-func BulkIndexDocuments(searcher types.Searcher, documents []types.Document) ([]types.Document, error) {
-	bodyLines := []string{}
-	createLine := fmt.Sprintf(`{"create":{"_index":"%s"}}`, searcher.IndexName)
-	for _, document := range documents {
-		body, err := json.Marshal(document)
-		if err != nil {
-			return nil, errors.New(`error marshalling document: ` + err.Error())
-		}
-		bodyLines = append(bodyLines, createLine)
-		bodyLines = append(bodyLines, string(body))
+// DocumentID derives the ID of a document from its network node and internal
+// ID, so that the same source document always maps to the same search
+// document.
+func DocumentID(networkNode string, internalID string) string {
+	hash := sha256.Sum256([]byte(networkNode + "\x00" + internalID))
+	return base64.RawURLEncoding.EncodeToString(hash[:])
+}
+
+// newDocumentID returns a random ID for a new document in the same form as
+// those generated by OpenSearch, eg. 'yQQEYY0B1VMrrWgmZN1j'. New documents
+// are given their ID before they are indexed so that it can be copied into
+// documentIDField.
+func newDocumentID() string {
+	id := make([]byte, 15)
+	rand.Read(id)
+	return base64.RawURLEncoding.EncodeToString(id)
+}
+
+// indexBody returns the source of document as indexed under id, with the ID
+// copied into documentIDField.
+func indexBody(document types.Document, id string) ([]byte, error) {
+	document.ID = ``
+	body, err := json.Marshal(document)
+	if err != nil {
+		return nil, err
 	}
-	body := strings.NewReader(strings.Join(bodyLines, "\n") + "\n")
-	req := opensearchapi.BulkRequest{
-		Body:    body,
-		Timeout: time.Second * 100,
-		//SourceIncludes: []string{`title`, `primary_url`},
+	var fields map[string]json.RawMessage
+	err = json.Unmarshal(body, &fields)
+	if err != nil {
+		return nil, err
 	}
-	response, err := req.Do(context.Background(), searcher.Client)
+	fields[documentIDField], _ = json.Marshal(id)
+	return json.Marshal(fields)
+}
+
+// Indexes a document under an ID derived from its network node and internal
+// ID, replacing any document previously indexed with the same node and
+// internal ID. Returns the indexed document and whether it was newly created.
+func UpsertDocument(ctx context.Context, searcher types.Searcher, document types.Document) (*types.Document, bool, error) {
+	if document.NetworkNode == `` || document.InternalID == `` {
+		return nil, false, errors.New(`network node and internal ID are required for upserting documents`)
+	}
+	id := DocumentID(document.NetworkNode, document.InternalID)
+	body, err := indexBody(document, id)
 	if err != nil {
-		return nil, errors.New(`error indexing documents: ` + err.Error())
+		return nil, false, errors.New(`error marshalling document: ` + err.Error())
+	}
+	req := opensearchapi.IndexRequest{
+		Index:      searcher.IndexName,
+		DocumentID: id,
+		Body:       strings.NewReader(string(body)),
+	}
+	response, err := req.Do(ctx, searcher.Client)
+	if err != nil {
+		return nil, false, errors.New(`error indexing document: ` + err.Error())
 	}
 	defer response.Body.Close()
-	if response.StatusCode != 200 {
+	if response.StatusCode != 200 && response.StatusCode != 201 {
 		bodyBytes, _ := io.ReadAll(response.Body)
-		return nil, errors.New(string(bodyBytes))
+		return nil, false, errors.New(string(bodyBytes))
+	}
+	var res indexDocumentResponse
+	err = json.NewDecoder(response.Body).Decode(&res)
+	if err != nil {
+		return nil, false, errors.New(`error decoding response: ` + err.Error())
 	}
+	document.ID = res.ID
+	return &document, res.Result == `created`, nil
+}
+
+// A single action in a bulk request. See:
+// https://opensearch.org/docs/latest/api-reference/document-apis/bulk/
+type bulkAction struct {
+	Action   string // One of create, index, update or delete
+	ID       string
+	Document types.Document
+}
+
+type bulkActionMetadata struct {
+	Index string `json:"_index"`
+	ID    string `json:"_id,omitempty"`
+}
 
-	var result struct {
-		Items []struct {
-			Create struct {
-				ID string `json:"_id"`
-			} `json:"create"`
-		} `json:"items"`
+type bulkResponse struct {
+	Errors bool                          `json:"errors"`
+	Items  []map[string]bulkResponseItem `json:"items"`
+}
+
+type bulkResponseItem struct {
+	ID     string `json:"_id"`
+	Status int    `json:"status"`
+	Result string `json:"result"`
+	Error  *struct {
+		Type   string `json:"type"`
+		Reason string `json:"reason"`
+	} `json:"error"`
+}
+
+// Indexes new documents in a single request. Returns one result per document,
+// in the same order as documents. A document that fails to index does not
+// prevent the others from being indexed; its result has a non-2xx status and
+// an error instead of an ID.
+func BulkIndexDocuments(ctx context.Context, searcher types.Searcher, documents []types.Document) ([]types.BulkItemResult, error) {
+	actions := []bulkAction{}
+	for _, document := range documents {
+		actions = append(actions, bulkAction{Action: `create`, ID: newDocumentID(), Document: document})
 	}
-	err = json.NewDecoder(response.Body).Decode(&result)
-	if err != nil {
-		return nil, errors.New(`error decoding response: ` + err.Error())
+	return runBulk(ctx, searcher, actions)
+}
+
+// Updates existing documents in a single request. Each document must have an
+// ID and only the fields provided are updated, as with UpdateDocument.
+// Results are as for BulkIndexDocuments.
+func BulkUpdateDocuments(ctx context.Context, searcher types.Searcher, documents []types.Document) ([]types.BulkItemResult, error) {
+	actions := []bulkAction{}
+	for _, document := range documents {
+		if document.ID == `` {
+			return nil, errors.New(`ID is required for updating documents`)
+		}
+		actions = append(actions, bulkAction{Action: `update`, ID: document.ID, Document: document})
+	}
+	return runBulk(ctx, searcher, actions)
+}
+
+// Upserts documents in a single request, as with UpsertDocument. Results are
+// as for BulkIndexDocuments, with a 201 status for created documents and 200
+// for replaced ones.
+func BulkUpsertDocuments(ctx context.Context, searcher types.Searcher, documents []types.Document) ([]types.BulkItemResult, error) {
+	actions := []bulkAction{}
+	for _, document := range documents {
+		if document.NetworkNode == `` || document.InternalID == `` {
+			return nil, errors.New(`network node and internal ID are required for upserting documents`)
+		}
+		actions = append(actions, bulkAction{
+			Action:   `index`,
+			ID:       DocumentID(document.NetworkNode, document.InternalID),
+			Document: document,
+		})
 	}
-	mgetLines := []string{}
-	for _, item := range result.Items {
-		mgetLines = append(mgetLines, `{"_id":"`+item.Create.ID+`"}`)
+	return runBulk(ctx, searcher, actions)
+}
+
+// Deletes documents by ID in a single request. Results are as for
+// BulkIndexDocuments, with a 404 status for documents that did not exist.
+func BulkDeleteDocuments(ctx context.Context, searcher types.Searcher, ids []string) ([]types.BulkItemResult, error) {
+	actions := []bulkAction{}
+	for _, id := range ids {
+		if id == `` {
+			return nil, errors.New(`ID is required for deleting documents`)
+		}
+		actions = append(actions, bulkAction{Action: `delete`, ID: id, Document: types.Document{ID: id}})
+	}
+	return runBulk(ctx, searcher, actions)
+}
+
+func runBulk(ctx context.Context, searcher types.Searcher, actions []bulkAction) ([]types.BulkItemResult, error) {
+	body, err := bulkRequestBody(searcher.IndexName, actions)
+	if err != nil {
+		return nil, err
 	}
-	mgetBody := strings.NewReader(`{"docs":[` + strings.Join(mgetLines, ",") + `]}`)
-	mreq := opensearchapi.MgetRequest{
-		Index: searcher.IndexName,
-		Body:  mgetBody,
+	req := opensearchapi.BulkRequest{
+		Body:    strings.NewReader(body),
+		Timeout: time.Second * 100,
 	}
-	mresponse, err := mreq.Do(context.Background(), searcher.Client)
+	response, err := req.Do(ctx, searcher.Client)
 	if err != nil {
-		return nil, errors.New(`error getting indexed documents: ` + err.Error())
+		return nil, errors.New(`error running bulk request: ` + err.Error())
 	}
-	defer mresponse.Body.Close()
-	if mresponse.StatusCode != 200 {
-		bodyBytes, _ := io.ReadAll(mresponse.Body)
+	defer response.Body.Close()
+	if response.StatusCode != 200 {
+		bodyBytes, _ := io.ReadAll(response.Body)
 		return nil, errors.New(string(bodyBytes))
 	}
-	var mgetResult struct {
-		Docs []struct {
-			ID     string         `json:"_id"`
-			Source types.Document `json:"_source"`
-		} `json:"docs"`
+	documents := []types.Document{}
+	for _, action := range actions {
+		documents = append(documents, action.Document)
 	}
-	err = json.NewDecoder(mresponse.Body).Decode(&mgetResult)
+	return bulkResponseToResults(response.Body, documents)
+}
+
+// Builds the newline-delimited JSON body of a bulk request.
+func bulkRequestBody(indexName string, actions []bulkAction) (string, error) {
+	bodyLines := []string{}
+	for _, action := range actions {
+		metadata, err := json.Marshal(map[string]bulkActionMetadata{
+			action.Action: {Index: indexName, ID: action.ID},
+		})
+		if err != nil {
+			return ``, errors.New(`error marshalling bulk action: ` + err.Error())
+		}
+		bodyLines = append(bodyLines, string(metadata))
+		document := action.Document
+		document.ID = ``
+		var body []byte
+		switch action.Action {
+		case `delete`:
+			continue
+		case `update`:
+			var fields map[string]json.RawMessage
+			fields, err = updateFields(document)
+			if err == nil {
+				body, err = json.Marshal(map[string]interface{}{"doc": fields})
+			}
+		default:
+			body, err = indexBody(document, action.ID)
+		}
+		if err != nil {
+			return ``, errors.New(`error marshalling document: ` + err.Error())
+		}
+		bodyLines = append(bodyLines, string(body))
+	}
+	return strings.Join(bodyLines, "\n") + "\n", nil
+}
+
+func bulkResponseToResults(responseBody io.Reader, documents []types.Document) ([]types.BulkItemResult, error) {
+	var result bulkResponse
+	err := json.NewDecoder(responseBody).Decode(&result)
 	if err != nil {
 		return nil, errors.New(`error decoding response: ` + err.Error())
 	}
-	indexedDocuments := []types.Document{}
-	for _, doc := range mgetResult.Docs {
-		doc.Source.ID = doc.ID
-		indexedDocuments = append(indexedDocuments, doc.Source)
+	if len(result.Items) != len(documents) {
+		return nil, fmt.Errorf(`expected %d items in bulk response, got %d`, len(documents), len(result.Items))
+	}
+	results := make([]types.BulkItemResult, 0, len(documents))
+	for i, item := range result.Items {
+		itemResult := types.BulkItemResult{
+			Index:    i,
+			Document: documents[i],
+		}
+		// Each item is keyed by its action, eg. {"create": {...}}.
+		for _, action := range item {
+			itemResult.Status = action.Status
+			if action.ID != `` {
+				itemResult.ID = action.ID
+			}
+			if action.Error != nil {
+				itemResult.Error = action.Error.Type + `: ` + action.Error.Reason
+			} else if !itemResult.Succeeded() {
+				itemResult.Error = action.Result
+			}
+		}
+		results = append(results, itemResult)
 	}
-	return indexedDocuments, nil
+	return results, nil
 }
 
-func GetDocument(searcher types.Searcher, id string) (*types.Document, error) {
+var ErrDocumentNotFound = errors.New(`document not found`)
+
+// Returns the document with id, or ErrDocumentNotFound if there is none.
+func GetDocument(ctx context.Context, searcher types.Searcher, id string) (*types.Document, error) {
 	req := opensearchapi.GetRequest{
 		Index:      searcher.IndexName,
 		DocumentID: id,
 	}
-	response, err := req.Do(context.Background(), searcher.Client)
+	response, err := req.Do(ctx, searcher.Client)
 	if err != nil {
 		return nil, errors.New(`error getting document: ` + err.Error())
 	}
 	defer response.Body.Close()
+	if response.StatusCode == 404 {
+		return nil, fmt.Errorf(`%w: %s`, ErrDocumentNotFound, id)
+	}
 	if response.StatusCode != 200 {
 		bodyBytes, _ := io.ReadAll(response.Body)
 		return nil, errors.New(string(bodyBytes))
@@ -159,13 +349,67 @@ func GetDocument(searcher types.Searcher, id string) (*types.Document, error) {
 	return &responseJSON.Source, nil
 }
 
-func UpdateDocument(searcher types.Searcher, document types.Document) error {
+// Returns the network node of each document with one of ids, fetched with a
+// single multi-get. Documents that do not exist are left out.
+func DocumentNetworkNodes(ctx context.Context, searcher types.Searcher, ids []string) (map[string]string, error) {
+	nodes := map[string]string{}
+	if len(ids) == 0 {
+		return nodes, nil
+	}
+	body, err := json.Marshal(map[string][]string{"ids": ids})
+	if err != nil {
+		return nil, err
+	}
+	req := opensearchapi.MgetRequest{
+		Index:          searcher.IndexName,
+		Body:           strings.NewReader(string(body)),
+		SourceIncludes: []string{"network_node"},
+	}
+	response, err := req.Do(ctx, searcher.Client)
+	if err != nil {
+		return nil, errors.New(`error getting documents: ` + err.Error())
+	}
+	defer response.Body.Close()
+	if response.StatusCode != 200 {
+		bodyBytes, _ := io.ReadAll(response.Body)
+		return nil, errors.New(string(bodyBytes))
+	}
+	var responseJSON struct {
+		Docs []struct {
+			ID     string `json:"_id"`
+			Found  bool   `json:"found"`
+			Source struct {
+				NetworkNode string `json:"network_node"`
+			} `json:"_source"`
+			Error *struct {
+				Type   string `json:"type"`
+				Reason string `json:"reason"`
+			} `json:"error"`
+		} `json:"docs"`
+	}
+	err = json.NewDecoder(response.Body).Decode(&responseJSON)
+	if err != nil {
+		return nil, errors.New(`error decoding response: ` + err.Error())
+	}
+	for _, doc := range responseJSON.Docs {
+		if doc.Error != nil {
+			return nil, fmt.Errorf(`error getting document %s: %s: %s`, doc.ID, doc.Error.Type, doc.Error.Reason)
+		}
+		if doc.Found {
+			nodes[doc.ID] = doc.Source.NetworkNode
+		}
+	}
+	return nodes, nil
+}
+
+func UpdateDocument(ctx context.Context, searcher types.Searcher, document types.Document) error {
 	id := document.ID
 	document.ID = ``
-	body := struct {
-		Doc types.Document `json:"doc"`
-	}{Doc: document}
-	reqBody, err := json.Marshal(body)
+	fields, err := updateFields(document)
+	if err != nil {
+		return err
+	}
+	reqBody, err := json.Marshal(map[string]interface{}{"doc": fields})
 	if err != nil {
 		return errors.New(`error marshalling document: ` + err.Error())
 	}
@@ -174,7 +418,7 @@ func UpdateDocument(searcher types.Searcher, document types.Document) error {
 		Body:       strings.NewReader(string(reqBody)),
 		DocumentID: id,
 	}
-	response, err := req.Do(context.Background(), searcher.Client)
+	response, err := req.Do(ctx, searcher.Client)
 	if err != nil {
 		return err
 	}
@@ -186,21 +430,53 @@ func UpdateDocument(searcher types.Searcher, document types.Document) error {
 	return err
 }
 
-func DeleteDocument(searcher types.Searcher, id string) error {
+// updateFields returns the fields of document that a partial update sets.
+// Documents always marshal a title and owner, so empty ones are left out
+// rather than blanking the stored ones. Lists given as [] are kept, so that an
+// update can clear them, eg. revoke access by emptying allowed_users.
+func updateFields(document types.Document) (map[string]json.RawMessage, error) {
+	documentJSON, err := json.Marshal(document)
+	if err != nil {
+		return nil, errors.New(`error marshalling document: ` + err.Error())
+	}
+	fields := map[string]json.RawMessage{}
+	err = json.Unmarshal(documentJSON, &fields)
+	if err != nil {
+		return nil, errors.New(`error marshalling document: ` + err.Error())
+	}
+	if document.Title == `` {
+		delete(fields, "title")
+	}
+	if document.Owner == (types.User{}) {
+		delete(fields, "owner")
+	}
+	value := reflect.ValueOf(document)
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Field(i)
+		if field.Kind() != reflect.Slice || field.IsNil() || field.Len() > 0 {
+			continue
+		}
+		name, _, _ := strings.Cut(value.Type().Field(i).Tag.Get("json"), ",")
+		fields[name] = json.RawMessage(`[]`)
+	}
+	return fields, nil
+}
+
+func DeleteDocument(ctx context.Context, searcher types.Searcher, id string) error {
 	req := opensearchapi.DeleteRequest{
 		Index:      searcher.IndexName,
 		DocumentID: id,
 	}
-	_, err := req.Do(context.Background(), searcher.Client)
+	_, err := req.Do(ctx, searcher.Client)
 	return err
 }
 
-func DeleteNode(searcher types.Searcher, node string) error {
+func DeleteNode(ctx context.Context, searcher types.Searcher, node string) error {
 	req := opensearchapi.DeleteByQueryRequest{
 		Index: []string{searcher.IndexName},
-		Body:  strings.NewReader(`{"query":{"match":{"network_node":"` + node + `"}}}`),
+		Body:  deleteNodeQuery(node).reader(),
 	}
-	response, err := req.Do(context.Background(), searcher.Client)
+	response, err := req.Do(ctx, searcher.Client)
 	if err != nil {
 		return err
 	}
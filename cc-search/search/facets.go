@@ -0,0 +1,126 @@
+package search
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/MESH-Research/commons-connect/cc-search/types"
+)
+
+// Maximum number of buckets returned for each terms facet.
+const facetSize = 50
+
+type termsAggregation struct {
+	Terms struct {
+		Field string `json:"field"`
+		Size  int    `json:"size,omitempty"`
+	} `json:"terms"`
+}
+
+type dateHistogramAggregation struct {
+	DateHistogram struct {
+		Field            string `json:"field"`
+		CalendarInterval string `json:"calendar_interval"`
+		Format           string `json:"format,omitempty"`
+		MinDocCount      int    `json:"min_doc_count"`
+	} `json:"date_histogram"`
+}
+
+func newTermsAggregation(field string) termsAggregation {
+	aggregation := termsAggregation{}
+	aggregation.Terms.Field = field
+	aggregation.Terms.Size = facetSize
+	return aggregation
+}
+
+func newYearHistogramAggregation(field string) dateHistogramAggregation {
+	aggregation := dateHistogramAggregation{}
+	aggregation.DateHistogram.Field = field
+	aggregation.DateHistogram.CalendarInterval = "year"
+	aggregation.DateHistogram.Format = "yyyy"
+	aggregation.DateHistogram.MinDocCount = 1
+	return aggregation
+}
+
+// Facets that can be requested with the `facets` search parameter, keyed by
+// facet name.
+var facetAggregations = map[string]interface{}{
+	"content_type":          newTermsAggregation("content_type"),
+	"network_node":          newTermsAggregation("network_node"),
+	"language":              newTermsAggregation("language"),
+	"contributors.username": newTermsAggregation("contributors.username"),
+	"publication_year":      newYearHistogramAggregation("publication_date"),
+}
+
+// FacetNames returns the names of all facets that can be requested, sorted.
+func FacetNames() []string {
+	names := make([]string, 0, len(facetAggregations))
+	for name := range facetAggregations {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ParseFacets parses a comma-separated list of facet names, eg.
+// `content_type,network_node`. Unknown facet names are an error.
+func ParseFacets(facetList string) ([]string, error) {
+	facets := []string{}
+	for _, facet := range strings.Split(facetList, ",") {
+		facet = strings.TrimSpace(facet)
+		if facet == "" {
+			continue
+		}
+		if _, ok := facetAggregations[facet]; !ok {
+			return nil, fmt.Errorf(
+				`invalid facet: %s (valid facets: %s)`,
+				facet,
+				strings.Join(FacetNames(), ", "),
+			)
+		}
+		facets = append(facets, facet)
+	}
+	if len(facets) == 0 {
+		return nil, errors.New(`no facets provided`)
+	}
+	return facets, nil
+}
+
+func buildAggregations(facets []string) map[string]interface{} {
+	if len(facets) == 0 {
+		return nil
+	}
+	aggregations := make(map[string]interface{})
+	for _, facet := range facets {
+		aggregation, ok := facetAggregations[facet]
+		if !ok {
+			continue
+		}
+		aggregations[facet] = aggregation
+	}
+	return aggregations
+}
+
+func searchResultToFacets(searchResult *types.SearchResult) map[string][]types.FacetBucket {
+	if len(searchResult.Aggregations) == 0 {
+		return nil
+	}
+	facets := make(map[string][]types.FacetBucket)
+	for name, aggregation := range searchResult.Aggregations {
+		buckets := make([]types.FacetBucket, 0, len(aggregation.Buckets))
+		for _, bucket := range aggregation.Buckets {
+			value := bucket.KeyAsString
+			if value == "" {
+				value = fmt.Sprint(bucket.Key)
+			}
+			buckets = append(buckets, types.FacetBucket{
+				Value: value,
+				Count: bucket.DocCount,
+			})
+		}
+		facets[name] = buckets
+	}
+	return facets
+}
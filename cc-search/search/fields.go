@@ -0,0 +1,118 @@
+package search
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/MESH-Research/commons-connect/cc-search/types"
+)
+
+// Fields that cannot be used in search parameters. Access control fields are
+// applied from the viewer context instead.
+var reservedFields = []string{"_internal_id", "_document_id", "visibility", "allowed_groups", "allowed_users"}
+
+// Field types whose values are indexed whole, so that they can be matched
+// exactly and sorted on without fielddata. Text fields are analyzed into
+// terms, so an exact match against them would rarely match.
+var exactTypes = []string{"keyword", "date"}
+
+var (
+	filterFields = mappedFields(isExactField)
+	sortFields   = mappedFields(isExactField)
+	returnFields = documentJSONFields()
+)
+
+func isExactField(mapping types.OSFieldMapping) bool {
+	return (mapping.Index == nil || *mapping.Index) && slices.Contains(exactTypes, mapping.Type)
+}
+
+// mappedFields returns the dotted paths of the fields in the embedded index
+// mappings that include returns true for, including multi-fields such as
+// title.keyword, sorted. Object fields are not included.
+func mappedFields(include func(types.OSFieldMapping) bool) []string {
+	var settings types.OSIndexSettings
+	err := json.Unmarshal(indexSettings, &settings)
+	if err != nil || settings.Mappings == nil {
+		panic(fmt.Sprintf(`error parsing embedded index settings: %v`, err))
+	}
+	fields := []string{}
+	var walk func(properties map[string]types.OSFieldMapping, prefix string)
+	walk = func(properties map[string]types.OSFieldMapping, prefix string) {
+		for name, mapping := range properties {
+			path := prefix + name
+			if mapping.Properties != nil {
+				walk(mapping.Properties, path+".")
+				continue
+			}
+			if include(mapping) && !slices.Contains(reservedFields, path) {
+				fields = append(fields, path)
+			}
+			walk(mapping.Fields, path+".")
+		}
+	}
+	walk(settings.Mappings.Properties, "")
+	sort.Strings(fields)
+	return fields
+}
+
+// documentJSONFields returns the JSON names of the top-level fields of a
+// document, sorted.
+func documentJSONFields() []string {
+	fields := []string{}
+	rt := reflect.TypeOf(types.Document{})
+	for i := 0; i < rt.NumField(); i++ {
+		name, _, _ := strings.Cut(rt.Field(i).Tag.Get("json"), ",")
+		if name != "" && !strings.HasPrefix(name, "_") && !slices.Contains(reservedFields, name) {
+			fields = append(fields, name)
+		}
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// FilterFields returns the fields that exact-match filters may be applied to,
+// sorted.
+func FilterFields() []string {
+	return slices.Clone(filterFields)
+}
+
+// ParseReturnFields parses a comma-separated list of document fields to
+// return. Only top-level document fields are allowed.
+func ParseReturnFields(fieldList string) ([]string, error) {
+	fields := []string{}
+	for _, field := range strings.Split(fieldList, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		if !slices.Contains(returnFields, field) {
+			return nil, fmt.Errorf(
+				`invalid field: %s (valid fields: %s)`,
+				field,
+				strings.Join(returnFields, ", "),
+			)
+		}
+		fields = append(fields, field)
+	}
+	if len(fields) == 0 {
+		return nil, errors.New(`no fields provided`)
+	}
+	return fields, nil
+}
+
+// ValidateSortField returns an error unless results can be sorted by field.
+func ValidateSortField(field string) error {
+	if !slices.Contains(sortFields, field) {
+		return fmt.Errorf(
+			`invalid sort field: %s (valid sort fields: %s)`,
+			field,
+			strings.Join(sortFields, ", "),
+		)
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package search
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// HighlightFields are the fields that matched fragments can be returned for.
+// These are also the fields highlighted when none are requested.
+var HighlightFields = []string{"title", "description", "content"}
+
+type highlightData struct {
+	FragmentSize int                 `json:"fragment_size,omitempty"`
+	Fields       map[string]struct{} `json:"fields"`
+}
+
+// ParseHighlightFields parses a comma-separated list of fields to highlight.
+// Only fields in HighlightFields are allowed.
+func ParseHighlightFields(fieldList string) ([]string, error) {
+	fields := []string{}
+	for _, field := range strings.Split(fieldList, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		if !slices.Contains(HighlightFields, field) {
+			return nil, fmt.Errorf(
+				`invalid highlight field: %s (valid fields: %s)`,
+				field,
+				strings.Join(HighlightFields, ", "),
+			)
+		}
+		fields = append(fields, field)
+	}
+	if len(fields) == 0 {
+		return nil, errors.New(`no highlight fields provided`)
+	}
+	return fields, nil
+}
+
+func buildHighlight(fields []string, fragmentSize int) *highlightData {
+	if len(fields) == 0 {
+		fields = HighlightFields
+	}
+	highlight := highlightData{
+		FragmentSize: fragmentSize,
+		Fields:       make(map[string]struct{}),
+	}
+	for _, field := range fields {
+		highlight.Fields[field] = struct{}{}
+	}
+	return &highlight
+}
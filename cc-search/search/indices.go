@@ -9,6 +9,9 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/MESH-Research/commons-connect/cc-search/types"
 	opensearchapi "github.com/opensearch-project/opensearch-go/v2/opensearchapi"
@@ -17,77 +20,176 @@ import (
 //go:embed index_settings.json
 var indexSettings []byte
 
-func MaybeCreateIndex(searcher *types.Searcher) error {
-	return MaybeCreateCustomIndex(searcher, indexSettings)
+func MaybeCreateIndex(ctx context.Context, searcher *types.Searcher) error {
+	return MaybeCreateCustomIndex(ctx, searcher, indexSettings)
 }
 
-func MaybeCreateCustomIndex(searcher *types.Searcher, settingsJSON []byte) error {
+func MaybeCreateCustomIndex(ctx context.Context, searcher *types.Searcher, settingsJSON []byte) error {
 	if searcher.IndexName == `` {
 		return errors.New(`index name is required`)
 	}
 	req := opensearchapi.IndicesExistsRequest{
 		Index: []string{searcher.IndexName},
 	}
-	response, err := req.Do(context.Background(), searcher.Client)
+	response, err := req.Do(ctx, searcher.Client)
 	if err != nil {
 		return err
 	}
 	defer response.Body.Close()
 	if response.StatusCode == 200 {
-		return nil
+		return mapDocumentIDField(ctx, searcher)
 	}
-	return CreateCustomIndex(searcher, settingsJSON)
+	return CreateCustomIndex(ctx, searcher, settingsJSON)
 }
 
-func CreateIndex(searcher *types.Searcher) error {
-	return CreateCustomIndex(searcher, indexSettings)
+// Adds documentIDField to the mappings of an existing index created before
+// the field was, so that the IDs copied into it are not mapped dynamically as
+// text, which cannot be sorted on. Indices that already map it are unchanged.
+func mapDocumentIDField(ctx context.Context, searcher *types.Searcher) error {
+	body, err := json.Marshal(map[string]interface{}{
+		`properties`: map[string]types.OSFieldMapping{
+			documentIDField: {Type: `keyword`, Index: new(bool)},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	req := opensearchapi.IndicesPutMappingRequest{
+		Index: []string{searcher.IndexName},
+		Body:  bytes.NewReader(body),
+	}
+	response, err := req.Do(ctx, searcher.Client)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != 200 {
+		bodyBytes, _ := io.ReadAll(response.Body)
+		return errors.New(`error mapping document ID field: ` + string(bodyBytes))
+	}
+	return nil
+}
+
+func CreateIndex(ctx context.Context, searcher *types.Searcher) error {
+	return CreateCustomIndex(ctx, searcher, indexSettings)
+}
+
+// Creates a new physical index for searcher.IndexName with searcher.IndexName
+// as an alias pointing to it. All requests go through the alias, so the
+// physical index can later be replaced with Reindex without downtime.
+func CreateCustomIndex(ctx context.Context, searcher *types.Searcher, settingsJSON []byte) error {
+	_, err := createVersionedIndex(ctx, searcher, settingsJSON, true)
+	return err
 }
 
-func CreateCustomIndex(searcher *types.Searcher, settingsJSON []byte) error {
+// Physical indices are named after the alias and their creation time to the
+// millisecond, eg. 'dev-search-20240315093000123'.
+func versionedIndexName(alias string) string {
+	created := time.Now().UTC().Format(`20060102150405.000`)
+	return alias + `-` + strings.Replace(created, `.`, ``, 1)
+}
+
+func createVersionedIndex(ctx context.Context, searcher *types.Searcher, settingsJSON []byte, withAlias bool) (string, error) {
+	var settings map[string]interface{}
+	err := json.Unmarshal(settingsJSON, &settings)
+	if err != nil {
+		return ``, errors.New(`error parsing index settings: ` + err.Error())
+	}
+	if withAlias {
+		settings[`aliases`] = map[string]interface{}{
+			searcher.IndexName: map[string]interface{}{},
+		}
+	}
+	body, err := json.Marshal(settings)
+	if err != nil {
+		return ``, err
+	}
 	req := opensearchapi.IndicesCreateRequest{
-		Index: searcher.IndexName,
-		Body:  bytes.NewReader(settingsJSON),
+		Index: versionedIndexName(searcher.IndexName),
+		Body:  bytes.NewReader(body),
 	}
-	response, err := req.Do(context.Background(), searcher.Client)
+	response, err := req.Do(ctx, searcher.Client)
 	if err != nil {
-		return err
+		return ``, err
 	}
 	defer response.Body.Close()
 	responseText, err := io.ReadAll(response.Body)
 	if err != nil {
-		return err
+		return ``, err
 	}
 	var result map[string]interface{}
 	err = json.Unmarshal(responseText, &result)
 	if err != nil {
-		return err
+		return ``, err
 	}
 	index, ok := result["index"]
 	if !ok {
 		log.Println(`No index in response: `, result)
-		return errors.New(`no index in response: `)
+		return ``, errors.New(`no index in response: `)
 	}
-	searcher.IndexName = index.(string)
-	return nil
+	return index.(string), nil
+}
+
+// Returns the names of the physical indices behind searcher.IndexName. If
+// IndexName is itself a physical index rather than an alias, it is returned.
+// Returns an empty list if the index does not exist.
+func concreteIndices(ctx context.Context, searcher *types.Searcher) ([]string, error) {
+	req := opensearchapi.IndicesGetAliasRequest{
+		Index: []string{searcher.IndexName},
+	}
+	response, err := req.Do(ctx, searcher.Client)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode == 404 {
+		return []string{}, nil
+	}
+	if response.StatusCode != 200 {
+		bodyBytes, _ := io.ReadAll(response.Body)
+		return nil, errors.New(string(bodyBytes))
+	}
+	var result map[string]interface{}
+	err = json.NewDecoder(response.Body).Decode(&result)
+	if err != nil {
+		return nil, err
+	}
+	indices := []string{}
+	for index := range result {
+		indices = append(indices, index)
+	}
+	sort.Strings(indices)
+	return indices, nil
 }
 
-func ResetIndex(searcher *types.Searcher) error {
-	return ResetCustomIndex(searcher, indexSettings)
+func ResetIndex(ctx context.Context, searcher *types.Searcher) error {
+	return ResetCustomIndex(ctx, searcher, indexSettings)
 }
 
-func ResetCustomIndex(searcher *types.Searcher, settingsJSON []byte) error {
-	err := DeleteIndex(searcher)
-	if err != nil {
+func ResetCustomIndex(ctx context.Context, searcher *types.Searcher, settingsJSON []byte) error {
+	err := DeleteIndex(ctx, searcher)
+	if err != nil && !errors.Is(err, ErrIndexNotFound) {
 		return err
 	}
-	return CreateCustomIndex(searcher, settingsJSON)
+	return CreateCustomIndex(ctx, searcher, settingsJSON)
 }
 
-func DeleteIndex(searcher *types.Searcher) error {
+var ErrIndexNotFound = errors.New(`index not found`)
+
+// Deletes the physical indices behind searcher.IndexName, along with the
+// alias. Returns ErrIndexNotFound if there is no such index.
+func DeleteIndex(ctx context.Context, searcher *types.Searcher) error {
+	indices, err := concreteIndices(ctx, searcher)
+	if err != nil {
+		return err
+	}
+	if len(indices) == 0 {
+		return fmt.Errorf(`%w: %s`, ErrIndexNotFound, searcher.IndexName)
+	}
 	req := opensearchapi.IndicesDeleteRequest{
-		Index: []string{searcher.IndexName},
+		Index: indices,
 	}
-	response, err := req.Do(context.Background(), searcher.Client)
+	response, err := req.Do(ctx, searcher.Client)
 	if err != nil {
 		return err
 	}
@@ -98,11 +200,257 @@ func DeleteIndex(searcher *types.Searcher) error {
 	return nil
 }
 
-func GetIndexInfo(searcher *types.Searcher) (map[string]interface{}, error) {
+// Rebuilds the index with the embedded index settings without taking search
+// offline. See ReindexCustom.
+func Reindex(ctx context.Context, searcher *types.Searcher) (*types.ReindexResult, error) {
+	return ReindexCustom(ctx, searcher, indexSettings)
+}
+
+// Creates a new physical index with settingsJSON, copies all documents into it
+// with _reindex, then atomically points the searcher.IndexName alias at the new
+// index and removes the previous ones. If searcher.IndexName is a physical
+// index rather than an alias, it is replaced by an alias of the same name.
+//
+// Writes to the previous indices are blocked while the copy runs, so that no
+// document written meanwhile is lost with them. Writes are allowed again if
+// the reindex fails.
+func ReindexCustom(ctx context.Context, searcher *types.Searcher, settingsJSON []byte) (*types.ReindexResult, error) {
+	previousIndices, err := concreteIndices(ctx, searcher)
+	if err != nil {
+		return nil, err
+	}
+	if len(previousIndices) == 0 {
+		return nil, fmt.Errorf(`index %s does not exist`, searcher.IndexName)
+	}
+	newIndex, err := createVersionedIndex(ctx, searcher, settingsJSON, false)
+	if err != nil {
+		return nil, err
+	}
+	// Cleaning up and swapping the alias must not be abandoned part way when
+	// ctx is cancelled, or a failed swap could delete the index being served.
+	cleanupCtx := context.WithoutCancel(ctx)
+	err = blockWrites(ctx, searcher, previousIndices, true)
+	if err != nil {
+		blockWrites(cleanupCtx, searcher, previousIndices, false)
+		deleteIndexByName(cleanupCtx, searcher, newIndex)
+		return nil, err
+	}
+	documents, err := copyDocuments(ctx, searcher, searcher.IndexName, newIndex)
+	if err == nil {
+		err = swapAlias(cleanupCtx, searcher, previousIndices, newIndex)
+	}
+	if err != nil {
+		blockWrites(cleanupCtx, searcher, previousIndices, false)
+		// A copy that could not be stopped would recreate a deleted index.
+		if !errors.Is(err, errCopyRunning) {
+			deleteIndexByName(cleanupCtx, searcher, newIndex)
+		}
+		return nil, err
+	}
+	return &types.ReindexResult{
+		PreviousIndices: previousIndices,
+		NewIndex:        newIndex,
+		Documents:       documents,
+	}, nil
+}
+
+// Sets or clears the write block of indices.
+func blockWrites(ctx context.Context, searcher *types.Searcher, indices []string, block bool) error {
+	body, err := json.Marshal(map[string]bool{`index.blocks.write`: block})
+	if err != nil {
+		return err
+	}
+	req := opensearchapi.IndicesPutSettingsRequest{
+		Index: indices,
+		Body:  bytes.NewReader(body),
+	}
+	response, err := req.Do(ctx, searcher.Client)
+	if err != nil {
+		if !block {
+			log.Println(`Error unblocking writes to `, indices, `: `, err)
+		}
+		return errors.New(`error updating index settings: ` + err.Error())
+	}
+	defer response.Body.Close()
+	if response.StatusCode != 200 {
+		bodyBytes, _ := io.ReadAll(response.Body)
+		if !block {
+			log.Println(`Error unblocking writes to `, indices, `: `, string(bodyBytes))
+		}
+		return errors.New(string(bodyBytes))
+	}
+	return nil
+}
+
+// How often copyDocuments checks whether the copy has finished.
+var taskPollInterval = time.Second
+
+// How long copyDocuments waits for a cancelled copy to stop.
+var taskStopTimeout = time.Minute
+
+// errCopyRunning is returned when a copy was abandoned but could not be
+// stopped, so its destination index is still being written to.
+var errCopyRunning = errors.New(`copy is still running`)
+
+type taskStatus struct {
+	Completed bool `json:"completed"`
+	Response  struct {
+		Total    int64         `json:"total"`
+		Failures []interface{} `json:"failures"`
+	} `json:"response"`
+	Error *struct {
+		Type   string `json:"type"`
+		Reason string `json:"reason"`
+	} `json:"error"`
+}
+
+// Copies all documents from source into dest, returning the number of
+// documents copied. The copy runs as a background task that is polled until
+// it completes, so it is not bound by the client's response timeout. If ctx
+// ends first, the task is cancelled.
+func copyDocuments(ctx context.Context, searcher *types.Searcher, source string, dest string) (int64, error) {
+	body, err := json.Marshal(map[string]interface{}{
+		`source`: map[string]string{`index`: source},
+		`dest`:   map[string]string{`index`: dest},
+		// Documents indexed before their ID was copied into the source are
+		// given the copy here.
+		`script`: map[string]string{
+			`source`: `ctx._source['` + documentIDField + `'] = ctx._id`,
+			`lang`:   `painless`,
+		},
+	})
+	if err != nil {
+		return 0, err
+	}
+	waitForCompletion := false
+	refresh := true
+	req := opensearchapi.ReindexRequest{
+		Body:              bytes.NewReader(body),
+		WaitForCompletion: &waitForCompletion,
+		Refresh:           &refresh,
+	}
+	response, err := req.Do(ctx, searcher.Client)
+	if err != nil {
+		return 0, errors.New(`error reindexing documents: ` + err.Error())
+	}
+	defer response.Body.Close()
+	if response.StatusCode != 200 {
+		bodyBytes, _ := io.ReadAll(response.Body)
+		return 0, errors.New(string(bodyBytes))
+	}
+	var started struct {
+		Task string `json:"task"`
+	}
+	err = json.NewDecoder(response.Body).Decode(&started)
+	if err != nil || started.Task == `` {
+		return 0, fmt.Errorf(`error decoding response: no task in reindex response: %v`, err)
+	}
+	status, err := waitForTask(ctx, searcher, started.Task)
+	if err != nil {
+		stopCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), taskStopTimeout)
+		defer cancel()
+		cancelTask(stopCtx, searcher, started.Task)
+		if _, stopErr := waitForTask(stopCtx, searcher, started.Task); stopErr != nil {
+			return 0, fmt.Errorf(`%w: task %s into %s: %v`, errCopyRunning, started.Task, dest, err)
+		}
+		return 0, err
+	}
+	if status.Error != nil {
+		return 0, errors.New(`error reindexing documents: ` + status.Error.Type + `: ` + status.Error.Reason)
+	}
+	if len(status.Response.Failures) > 0 {
+		return 0, fmt.Errorf(`%d documents failed to reindex: %v`, len(status.Response.Failures), status.Response.Failures[0])
+	}
+	return status.Response.Total, nil
+}
+
+// Polls the task with ID taskID until it completes or ctx ends.
+func waitForTask(ctx context.Context, searcher *types.Searcher, taskID string) (*taskStatus, error) {
+	for {
+		req := opensearchapi.TasksGetRequest{TaskID: taskID}
+		response, err := req.Do(ctx, searcher.Client)
+		if err != nil {
+			return nil, errors.New(`error getting task: ` + err.Error())
+		}
+		if response.StatusCode != 200 {
+			bodyBytes, _ := io.ReadAll(response.Body)
+			response.Body.Close()
+			return nil, errors.New(string(bodyBytes))
+		}
+		var status taskStatus
+		err = json.NewDecoder(response.Body).Decode(&status)
+		response.Body.Close()
+		if err != nil {
+			return nil, errors.New(`error decoding response: ` + err.Error())
+		}
+		if status.Completed {
+			return &status, nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(taskPollInterval):
+		}
+	}
+}
+
+func cancelTask(ctx context.Context, searcher *types.Searcher, taskID string) {
+	req := opensearchapi.TasksCancelRequest{TaskID: taskID}
+	response, err := req.Do(ctx, searcher.Client)
+	if err != nil {
+		log.Println(`Error cancelling task `, taskID, `: `, err)
+		return
+	}
+	response.Body.Close()
+}
+
+// Atomically points the searcher.IndexName alias at newIndex and removes the
+// previous indices.
+func swapAlias(ctx context.Context, searcher *types.Searcher, previousIndices []string, newIndex string) error {
+	actions := []map[string]interface{}{
+		{`add`: map[string]string{`index`: newIndex, `alias`: searcher.IndexName}},
+	}
+	for _, index := range previousIndices {
+		actions = append(actions, map[string]interface{}{
+			`remove_index`: map[string]string{`index`: index},
+		})
+	}
+	body, err := json.Marshal(map[string]interface{}{`actions`: actions})
+	if err != nil {
+		return err
+	}
+	req := opensearchapi.IndicesUpdateAliasesRequest{
+		Body: bytes.NewReader(body),
+	}
+	response, err := req.Do(ctx, searcher.Client)
+	if err != nil {
+		return errors.New(`error updating aliases: ` + err.Error())
+	}
+	defer response.Body.Close()
+	if response.StatusCode != 200 {
+		bodyBytes, _ := io.ReadAll(response.Body)
+		return errors.New(string(bodyBytes))
+	}
+	return nil
+}
+
+func deleteIndexByName(ctx context.Context, searcher *types.Searcher, index string) {
+	req := opensearchapi.IndicesDeleteRequest{
+		Index: []string{index},
+	}
+	response, err := req.Do(ctx, searcher.Client)
+	if err != nil {
+		log.Println(`Error deleting index `, index, `: `, err)
+		return
+	}
+	response.Body.Close()
+}
+
+func GetIndexInfo(ctx context.Context, searcher *types.Searcher) (map[string]interface{}, error) {
 	req := opensearchapi.IndicesGetRequest{
 		Index: []string{searcher.IndexName},
 	}
-	response, err := req.Do(context.Background(), searcher.Client)
+	response, err := req.Do(ctx, searcher.Client)
 	if err != nil {
 		log.Println(`Error getting index settings: `, err)
 		return nil, err
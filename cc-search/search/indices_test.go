@@ -0,0 +1,169 @@
+package search
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/MESH-Research/commons-connect/cc-search/types"
+)
+
+// reindexStub is a stand-in for OpenSearch that serves the requests made by
+// ReindexCustom for the alias test backed by the index test-1. The reindex
+// task is reported as running once before it completes with taskResult.
+func reindexStub(t *testing.T, taskResult string) (*httptest.Server, func() []string) {
+	var mu sync.Mutex
+	requests := []string{}
+	polls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		defer mu.Unlock()
+		// The new index is named after the current time, so it is recorded
+		// as {new index}. Only bodies that the test checks are recorded.
+		path := r.URL.Path
+		if strings.HasPrefix(path, "/test-") && !strings.HasPrefix(path, "/test-1/") {
+			path = "/{new index}"
+		}
+		request := r.Method + " " + path
+		if path == "/test-1/_settings" || path == "/_aliases" {
+			request += " " + string(body)
+		}
+		requests = append(requests, request)
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case r.URL.Path == "/test/_alias":
+			w.Write([]byte(`{"test-1":{"aliases":{"test":{}}}}`))
+		case path == "/{new index}" && r.Method == http.MethodPut:
+			w.Write([]byte(`{"acknowledged":true,"index":"` + strings.TrimPrefix(r.URL.Path, "/") + `"}`))
+		case r.URL.Path == "/_reindex":
+			if r.URL.Query().Get("wait_for_completion") != "false" {
+				t.Errorf("Expected reindex with wait_for_completion=false, got %s", r.URL.RawQuery)
+			}
+			w.Write([]byte(`{"task":"node:1"}`))
+		case r.URL.Path == "/_tasks/node:1":
+			polls++
+			if polls == 1 {
+				w.Write([]byte(`{"completed":false}`))
+				return
+			}
+			w.Write([]byte(taskResult))
+		default:
+			w.Write([]byte(`{"acknowledged":true}`))
+		}
+	}))
+	return server, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return slices.Clone(requests)
+	}
+}
+
+func TestReindexCustom(t *testing.T) {
+	defer func(interval time.Duration) { taskPollInterval = interval }(taskPollInterval)
+	taskPollInterval = time.Millisecond
+
+	tests := []struct {
+		name       string
+		taskResult string
+		wantErr    bool
+		requests   []string
+	}{
+		{
+			name:       "copy succeeds",
+			taskResult: `{"completed":true,"response":{"total":3,"failures":[]}}`,
+			requests: []string{
+				"GET /test/_alias",
+				"PUT /{new index}",
+				`PUT /test-1/_settings {"index.blocks.write":true}`,
+				"POST /_reindex",
+				"GET /_tasks/node:1",
+				"GET /_tasks/node:1",
+				"POST /_aliases",
+			},
+		},
+		{
+			name:       "copy fails",
+			taskResult: `{"completed":true,"response":{"total":3,"failures":[{"id":"a"}]}}`,
+			wantErr:    true,
+			requests: []string{
+				"GET /test/_alias",
+				"PUT /{new index}",
+				`PUT /test-1/_settings {"index.blocks.write":true}`,
+				"POST /_reindex",
+				"GET /_tasks/node:1",
+				"GET /_tasks/node:1",
+				`PUT /test-1/_settings {"index.blocks.write":false}`,
+				"DELETE /{new index}",
+			},
+		},
+	}
+	for _, tt := range tests {
+		server, requests := reindexStub(t, tt.taskResult)
+		client, err := GetClientNoAuth(server.URL, nil)
+		if err != nil {
+			t.Fatalf("%s: error getting client: %v", tt.name, err)
+		}
+		searcher := types.Searcher{IndexName: "test", Client: client}
+		result, err := ReindexCustom(context.Background(), &searcher, indexSettings)
+		server.Close()
+		if (err != nil) != tt.wantErr {
+			t.Fatalf("%s: expected error %v, got %v", tt.name, tt.wantErr, err)
+		}
+		if err == nil && (result.Documents != 3 || !slices.Equal(result.PreviousIndices, []string{"test-1"})) {
+			t.Errorf("%s: unexpected result %+v", tt.name, result)
+		}
+		got := requests()
+		for i, request := range got {
+			if strings.HasPrefix(request, "POST /_aliases") {
+				if !strings.Contains(request, `"remove_index":{"index":"test-1"}`) {
+					t.Errorf("%s: expected alias swap removing test-1, got %s", tt.name, request)
+				}
+				got[i] = "POST /_aliases"
+			}
+		}
+		if !slices.Equal(got, tt.requests) {
+			t.Errorf("%s: expected requests\n%s\ngot\n%s", tt.name, strings.Join(tt.requests, "\n"), strings.Join(got, "\n"))
+		}
+	}
+}
+
+func TestVersionedIndexName(t *testing.T) {
+	name := versionedIndexName("test")
+	if len(name) != len("test-20240315093000123") || !strings.HasPrefix(name, "test-") {
+		t.Errorf("Expected a millisecond timestamp after the alias, got %s", name)
+	}
+}
+
+func TestMaybeCreateIndexMapsDocumentID(t *testing.T) {
+	requests := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests = append(requests, r.Method+" "+r.URL.Path+" "+string(body))
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"acknowledged":true}`))
+	}))
+	defer server.Close()
+	client, err := GetClientNoAuth(server.URL, nil)
+	if err != nil {
+		t.Fatalf("Error getting client: %v", err)
+	}
+	searcher := types.Searcher{IndexName: "test", Client: client}
+	err = MaybeCreateIndex(context.Background(), &searcher)
+	if err != nil {
+		t.Fatalf("Error preparing existing index: %v", err)
+	}
+	expected := []string{
+		"HEAD /test ",
+		`PUT /test/_mapping {"properties":{"_document_id":{"type":"keyword","index":false}}}`,
+	}
+	if !slices.Equal(requests, expected) {
+		t.Errorf("Expected requests\n%s\ngot\n%s", strings.Join(expected, "\n"), strings.Join(requests, "\n"))
+	}
+}
@@ -0,0 +1,128 @@
+package search
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/MESH-Research/commons-connect/cc-search/types"
+)
+
+// Compares the mappings and settings of each index in indexInfo, as returned by
+// GetIndexInfo, against the embedded index settings. Returns the drift keyed by
+// index name.
+func IndexMappingDrift(indexInfo map[string]interface{}) (map[string]types.MappingDrift, error) {
+	var expected types.OSIndexSettings
+	err := json.Unmarshal(indexSettings, &expected)
+	if err != nil {
+		return nil, fmt.Errorf(`error parsing embedded index settings: %w`, err)
+	}
+	drift := make(map[string]types.MappingDrift)
+	for index, info := range indexInfo {
+		infoJSON, err := json.Marshal(info)
+		if err != nil {
+			return nil, err
+		}
+		var live types.OSIndexSettings
+		err = json.Unmarshal(infoJSON, &live)
+		if err != nil {
+			return nil, fmt.Errorf(`error parsing settings of index %s: %w`, index, err)
+		}
+		drift[index] = diffIndexSettings(expected, live)
+	}
+	return drift, nil
+}
+
+func diffIndexSettings(expected types.OSIndexSettings, live types.OSIndexSettings) types.MappingDrift {
+	drift := types.MappingDrift{
+		Added:   []string{},
+		Missing: []string{},
+		Changed: []types.MappingChange{},
+	}
+
+	expectedFields := map[string]string{}
+	if expected.Mappings != nil {
+		flattenMappings(expected.Mappings.Properties, "", expectedFields)
+	}
+	liveFields := map[string]string{}
+	if live.Mappings != nil {
+		flattenMappings(live.Mappings.Properties, "", liveFields)
+	}
+	for field, expectedDefinition := range expectedFields {
+		liveDefinition, ok := liveFields[field]
+		if !ok {
+			drift.Missing = append(drift.Missing, field)
+			continue
+		}
+		if liveDefinition != expectedDefinition {
+			drift.Changed = append(drift.Changed, types.MappingChange{
+				Field:    field,
+				Expected: expectedDefinition,
+				Actual:   liveDefinition,
+			})
+		}
+	}
+	for field := range liveFields {
+		if _, ok := expectedFields[field]; !ok {
+			drift.Added = append(drift.Added, field)
+		}
+	}
+
+	// Only settings given in the embedded settings are compared, since
+	// OpenSearch fills in defaults for the rest.
+	if expected.Settings != nil && expected.Settings.Index != nil {
+		var liveShards, liveReplicas int
+		if live.Settings != nil && live.Settings.Index != nil {
+			liveShards = live.Settings.Index.NumberOfShards
+			liveReplicas = live.Settings.Index.NumberOfReplicas
+		}
+		compareSetting(&drift, "settings.index.number_of_shards", expected.Settings.Index.NumberOfShards, liveShards)
+		compareSetting(&drift, "settings.index.number_of_replicas", expected.Settings.Index.NumberOfReplicas, liveReplicas)
+	}
+
+	sort.Strings(drift.Added)
+	sort.Strings(drift.Missing)
+	sort.Slice(drift.Changed, func(i, j int) bool {
+		return drift.Changed[i].Field < drift.Changed[j].Field
+	})
+	drift.InSync = len(drift.Added) == 0 && len(drift.Missing) == 0 && len(drift.Changed) == 0
+	return drift
+}
+
+func compareSetting(drift *types.MappingDrift, setting string, expected int, live int) {
+	if expected == 0 || expected == live {
+		return
+	}
+	drift.Changed = append(drift.Changed, types.MappingChange{
+		Field:    setting,
+		Expected: fmt.Sprint(expected),
+		Actual:   fmt.Sprint(live),
+	})
+}
+
+// Flattens nested mappings into fields keyed by their dotted path, eg.
+// owner.username or title.prefix, with a description of their definition.
+func flattenMappings(properties map[string]types.OSFieldMapping, prefix string, fields map[string]string) {
+	for name, mapping := range properties {
+		path := prefix + name
+		fields[path] = describeMapping(mapping)
+		flattenMappings(mapping.Fields, path+".", fields)
+		flattenMappings(mapping.Properties, path+".", fields)
+	}
+}
+
+func describeMapping(mapping types.OSFieldMapping) string {
+	fieldType := mapping.Type
+	if fieldType == "" {
+		fieldType = "object"
+	}
+	description := []string{"type=" + fieldType}
+	if mapping.Store {
+		description = append(description, "store=true")
+	}
+	if mapping.Index != nil && !*mapping.Index {
+		description = append(description, "index=false")
+	}
+	return strings.Join(description, " ")
+}
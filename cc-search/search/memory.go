@@ -0,0 +1,844 @@
+package search
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/MESH-Research/commons-connect/cc-search/types"
+)
+
+// MemoryBackend is a Backend that keeps documents in memory, for tests and
+// local development without an OpenSearch cluster. Text is matched through a
+// simple inverted index of lowercased terms, which approximates but does not
+// reproduce OpenSearch analysis and scoring. Fuzzy matching and points in
+// time are not supported.
+type MemoryBackend struct {
+	mu        sync.RWMutex
+	indexName string
+	physical  string
+	created   time.Time
+	documents map[string]types.Document
+	// Term frequencies keyed by field, then term, then document ID.
+	terms map[string]map[string]map[string]int
+}
+
+func NewMemoryBackend(indexName string) *MemoryBackend {
+	backend := &MemoryBackend{indexName: indexName}
+	backend.reset()
+	return backend
+}
+
+func (backend *MemoryBackend) reset() {
+	backend.physical = versionedIndexName(backend.indexName)
+	backend.created = time.Now()
+	backend.documents = make(map[string]types.Document)
+	backend.terms = make(map[string]map[string]map[string]int)
+}
+
+func (backend *MemoryBackend) IndexDocument(ctx context.Context, document types.Document) (*types.Document, error) {
+	if document.ID != `` {
+		return nil, errors.New(`ID should not be provided for new documents`)
+	}
+	backend.mu.Lock()
+	defer backend.mu.Unlock()
+	document.ID = newDocumentID()
+	backend.put(document)
+	return &document, nil
+}
+
+func (backend *MemoryBackend) UpsertDocument(ctx context.Context, document types.Document) (*types.Document, bool, error) {
+	if document.NetworkNode == `` || document.InternalID == `` {
+		return nil, false, errors.New(`network node and internal ID are required for upserting documents`)
+	}
+	backend.mu.Lock()
+	defer backend.mu.Unlock()
+	document.ID = DocumentID(document.NetworkNode, document.InternalID)
+	_, exists := backend.documents[document.ID]
+	backend.put(document)
+	return &document, !exists, nil
+}
+
+func (backend *MemoryBackend) GetDocument(ctx context.Context, id string) (*types.Document, error) {
+	backend.mu.RLock()
+	defer backend.mu.RUnlock()
+	document, ok := backend.documents[id]
+	if !ok {
+		return nil, fmt.Errorf(`%w: %s`, ErrDocumentNotFound, id)
+	}
+	return &document, nil
+}
+
+func (backend *MemoryBackend) DocumentNetworkNodes(ctx context.Context, ids []string) (map[string]string, error) {
+	backend.mu.RLock()
+	defer backend.mu.RUnlock()
+	nodes := map[string]string{}
+	for _, id := range ids {
+		if document, ok := backend.documents[id]; ok {
+			nodes[id] = document.NetworkNode
+		}
+	}
+	return nodes, nil
+}
+
+func (backend *MemoryBackend) UpdateDocument(ctx context.Context, document types.Document) error {
+	backend.mu.Lock()
+	defer backend.mu.Unlock()
+	return backend.update(document)
+}
+
+func (backend *MemoryBackend) DeleteDocument(ctx context.Context, id string) error {
+	backend.mu.Lock()
+	defer backend.mu.Unlock()
+	backend.remove(id)
+	return nil
+}
+
+func (backend *MemoryBackend) DeleteNode(ctx context.Context, node string) error {
+	backend.mu.Lock()
+	defer backend.mu.Unlock()
+	for id, document := range backend.documents {
+		if document.NetworkNode == node {
+			backend.remove(id)
+		}
+	}
+	return nil
+}
+
+func (backend *MemoryBackend) BulkIndexDocuments(ctx context.Context, documents []types.Document) ([]types.BulkItemResult, error) {
+	backend.mu.Lock()
+	defer backend.mu.Unlock()
+	results := make([]types.BulkItemResult, 0, len(documents))
+	for i, document := range documents {
+		if document.ID != `` {
+			results = append(results, types.BulkItemResult{
+				Index:    i,
+				Status:   400,
+				Error:    `ID should not be provided for new documents`,
+				Document: document,
+			})
+			continue
+		}
+		document.ID = newDocumentID()
+		backend.put(document)
+		results = append(results, types.BulkItemResult{Index: i, Status: 201, Document: document})
+	}
+	return results, nil
+}
+
+func (backend *MemoryBackend) BulkUpdateDocuments(ctx context.Context, documents []types.Document) ([]types.BulkItemResult, error) {
+	for _, document := range documents {
+		if document.ID == `` {
+			return nil, errors.New(`ID is required for updating documents`)
+		}
+	}
+	backend.mu.Lock()
+	defer backend.mu.Unlock()
+	results := make([]types.BulkItemResult, 0, len(documents))
+	for i, document := range documents {
+		result := types.BulkItemResult{Index: i, Status: 200, Document: document}
+		err := backend.update(document)
+		if err != nil {
+			result.Status = 404
+			result.Error = err.Error()
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+func (backend *MemoryBackend) BulkUpsertDocuments(ctx context.Context, documents []types.Document) ([]types.BulkItemResult, error) {
+	for _, document := range documents {
+		if document.NetworkNode == `` || document.InternalID == `` {
+			return nil, errors.New(`network node and internal ID are required for upserting documents`)
+		}
+	}
+	backend.mu.Lock()
+	defer backend.mu.Unlock()
+	results := make([]types.BulkItemResult, 0, len(documents))
+	for i, document := range documents {
+		document.ID = DocumentID(document.NetworkNode, document.InternalID)
+		status := 201
+		if _, exists := backend.documents[document.ID]; exists {
+			status = 200
+		}
+		backend.put(document)
+		results = append(results, types.BulkItemResult{Index: i, Status: status, Document: document})
+	}
+	return results, nil
+}
+
+func (backend *MemoryBackend) BulkDeleteDocuments(ctx context.Context, ids []string) ([]types.BulkItemResult, error) {
+	for _, id := range ids {
+		if id == `` {
+			return nil, errors.New(`ID is required for deleting documents`)
+		}
+	}
+	backend.mu.Lock()
+	defer backend.mu.Unlock()
+	results := make([]types.BulkItemResult, 0, len(ids))
+	for i, id := range ids {
+		result := types.BulkItemResult{Index: i, Status: 200, Document: types.Document{ID: id}}
+		if _, exists := backend.documents[id]; !exists {
+			result.Status = 404
+			result.Error = `not_found`
+		}
+		backend.remove(id)
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+func (backend *MemoryBackend) Search(ctx context.Context, params types.SearchParams) (types.SearchResponse, error) {
+	node, err := parseQueryString(params.Query)
+	if err != nil {
+		return types.SearchResponse{}, err
+	}
+	offset := 0
+	if params.Cursor != `` && params.Cursor != CursorStart {
+		c, err := decodeCursor(params.Cursor)
+		if err != nil {
+			return types.SearchResponse{}, err
+		}
+		if params.Sort != nil && !slices.Equal(params.Sort, c.Sort) {
+			return types.SearchResponse{}, fmt.Errorf(`%w: cursor was created with a different sort`, ErrInvalidCursor)
+		}
+		err = json.Unmarshal(c.SearchAfter[0], &offset)
+		if err != nil || offset < 0 {
+			return types.SearchResponse{}, fmt.Errorf(`%w: invalid search position`, ErrInvalidCursor)
+		}
+		params.Sort = c.Sort
+	}
+
+	backend.mu.RLock()
+	defer backend.mu.RUnlock()
+
+	scores := backend.score(node, params)
+	matches := make([]types.Document, 0, len(scores))
+	for id := range scores {
+		matches = append(matches, backend.documents[id])
+	}
+	sortKeys := params.Sort
+	if len(sortKeys) == 0 {
+		sortKeys = []types.SortKey{{Field: scoreField, Direction: sortDescending}}
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		a, b := matches[i], matches[j]
+		for _, key := range sortKeys {
+			var order int
+			if key.Field == scoreField {
+				order = cmp.Compare(scores[a.ID], scores[b.ID])
+			} else {
+				order = cmp.Compare(sortValue(a, key.Field), sortValue(b, key.Field))
+			}
+			if key.Direction == sortDescending {
+				order = -order
+			}
+			if order != 0 {
+				return order < 0
+			}
+		}
+		return a.ID < b.ID
+	})
+
+	size := pageSize(params)
+	if params.Cursor == `` && params.Page > 0 {
+		offset = (params.Page - 1) * size
+	}
+	page := []types.Document{}
+	if offset < len(matches) {
+		page = matches[offset:min(offset+size, len(matches))]
+	}
+
+	response := types.SearchResponse{
+		Total:     int64(len(matches)),
+		Page:      params.Page,
+		PerPage:   params.PerPage,
+		RequestID: params.RequestID,
+		Hits:      memoryHits(page, params),
+		Facets:    memoryFacets(matches, params.Facets),
+	}
+	if suggestionsWanted(params, response.Total) {
+		response.Suggestions = backend.suggestions(params)
+	}
+	if params.Cursor != `` && offset+size < len(matches) {
+		position, _ := json.Marshal(offset + size)
+		c := cursor{SearchAfter: []json.RawMessage{position}, Sort: params.Sort}
+		response.Cursor = encodeCursor(c)
+	}
+	return response, nil
+}
+
+func (backend *MemoryBackend) TypeAheadSearch(ctx context.Context, query string, viewer *types.Viewer) ([]types.Document, error) {
+	queryTerms := tokenize(query)
+	documents := []types.Document{}
+	if len(queryTerms) == 0 {
+		return documents, nil
+	}
+	backend.mu.RLock()
+	defer backend.mu.RUnlock()
+
+	// As with bool_prefix, every term must match and the last may match as a
+	// prefix.
+	last := queryTerms[len(queryTerms)-1]
+	for _, document := range backend.documents {
+		if !viewer.CanView(document) {
+			continue
+		}
+		titleTerms := tokenize(document.Title)
+		matched := true
+		for _, term := range queryTerms[:len(queryTerms)-1] {
+			if !containsTerm(titleTerms, term, false) {
+				matched = false
+				break
+			}
+		}
+		if matched && containsTerm(titleTerms, last, true) {
+			documents = append(documents, document)
+		}
+	}
+	sort.Slice(documents, func(i, j int) bool {
+		return documents[i].ID < documents[j].ID
+	})
+	if len(documents) > typeAheadSize {
+		documents = documents[:typeAheadSize]
+	}
+	for i := range documents {
+		documents[i].FilterByJSON(typeAheadFields)
+	}
+	return documents, nil
+}
+
+// RelatedDocuments scores documents by the terms they share with the title,
+// description and content of the document with id.
+func (backend *MemoryBackend) RelatedDocuments(ctx context.Context, id string, params types.SearchParams) (types.SearchResponse, error) {
+	backend.mu.RLock()
+	defer backend.mu.RUnlock()
+	source, ok := backend.documents[id]
+	if !ok {
+		return types.SearchResponse{}, fmt.Errorf(`%w: %s`, ErrDocumentNotFound, id)
+	}
+	text := strings.Join([]string{source.Title, source.Description, source.Content}, ` `)
+	params.SearchFields = relatedFields
+	matches := []types.Document{}
+	scores := map[string]float64{}
+	if len(tokenize(text)) > 0 {
+		scores = backend.score(textNode(text), params)
+		delete(scores, id)
+	}
+	for id := range scores {
+		matches = append(matches, backend.documents[id])
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		a, b := matches[i], matches[j]
+		if scores[a.ID] != scores[b.ID] {
+			return scores[a.ID] > scores[b.ID]
+		}
+		return a.ID < b.ID
+	})
+	page := matches[:min(pageSize(params), len(matches))]
+	return types.SearchResponse{
+		Total:   int64(len(matches)),
+		PerPage: params.PerPage,
+		Hits:    memoryHits(page, params),
+	}, nil
+}
+
+func (backend *MemoryBackend) MaybeCreateIndex(ctx context.Context) error {
+	if backend.indexName == `` {
+		return errors.New(`index name is required`)
+	}
+	return nil
+}
+
+func (backend *MemoryBackend) ResetIndex(ctx context.Context) error {
+	backend.mu.Lock()
+	defer backend.mu.Unlock()
+	backend.reset()
+	return nil
+}
+
+// Reindex moves the documents to a new physical index name. Documents are
+// re-analyzed in place, since there are no stored mappings to change.
+func (backend *MemoryBackend) Reindex(ctx context.Context) (*types.ReindexResult, error) {
+	backend.mu.Lock()
+	defer backend.mu.Unlock()
+	result := &types.ReindexResult{
+		PreviousIndices: []string{backend.physical},
+		NewIndex:        versionedIndexName(backend.indexName),
+		Documents:       int64(len(backend.documents)),
+	}
+	backend.physical = result.NewIndex
+	backend.created = time.Now()
+	return result, nil
+}
+
+// GetIndexInfo returns index information shaped like the OpenSearch get index
+// API, with the embedded index settings as the mappings.
+func (backend *MemoryBackend) GetIndexInfo(ctx context.Context) (map[string]interface{}, error) {
+	var info map[string]interface{}
+	err := json.Unmarshal(indexSettings, &info)
+	if err != nil {
+		return nil, fmt.Errorf(`error parsing embedded index settings: %w`, err)
+	}
+	backend.mu.RLock()
+	defer backend.mu.RUnlock()
+	info[`aliases`] = map[string]interface{}{backend.indexName: map[string]interface{}{}}
+	info[`settings`] = map[string]interface{}{
+		`index`: map[string]interface{}{
+			`creation_date`:      strconv.FormatInt(backend.created.UnixMilli(), 10),
+			`number_of_shards`:   `1`,
+			`number_of_replicas`: `0`,
+			`provided_name`:      backend.physical,
+		},
+	}
+	return map[string]interface{}{backend.physical: info}, nil
+}
+
+func (backend *MemoryBackend) CountDocuments(ctx context.Context) (int64, error) {
+	backend.mu.RLock()
+	defer backend.mu.RUnlock()
+	return int64(len(backend.documents)), nil
+}
+
+// put stores document, replacing any document with the same ID. The caller
+// must hold the write lock.
+func (backend *MemoryBackend) put(document types.Document) {
+	backend.remove(document.ID)
+	backend.documents[document.ID] = document
+	for field, values := range documentFields(document) {
+		for _, value := range values {
+			for _, term := range tokenize(value) {
+				if backend.terms[field] == nil {
+					backend.terms[field] = make(map[string]map[string]int)
+				}
+				if backend.terms[field][term] == nil {
+					backend.terms[field][term] = make(map[string]int)
+				}
+				backend.terms[field][term][document.ID]++
+			}
+		}
+	}
+}
+
+// remove deletes the document with id, if any. The caller must hold the
+// write lock.
+func (backend *MemoryBackend) remove(id string) {
+	document, ok := backend.documents[id]
+	if !ok {
+		return
+	}
+	delete(backend.documents, id)
+	for field, values := range documentFields(document) {
+		for _, value := range values {
+			for _, term := range tokenize(value) {
+				delete(backend.terms[field][term], id)
+				if len(backend.terms[field][term]) == 0 {
+					delete(backend.terms[field], term)
+				}
+			}
+		}
+	}
+}
+
+// update merges the fields set in document into the stored document with the
+// same ID, as a partial update does in OpenSearch. The caller must hold the
+// write lock.
+func (backend *MemoryBackend) update(document types.Document) error {
+	existing, ok := backend.documents[document.ID]
+	if !ok {
+		return fmt.Errorf(`document %s not found`, document.ID)
+	}
+	id := document.ID
+	document.ID = ``
+	merged := map[string]json.RawMessage{}
+	existingJSON, _ := json.Marshal(existing)
+	json.Unmarshal(existingJSON, &merged)
+	fields, err := updateFields(document)
+	if err != nil {
+		return err
+	}
+	for name, value := range fields {
+		merged[name] = value
+	}
+	mergedJSON, _ := json.Marshal(merged)
+	var updated types.Document
+	err = json.Unmarshal(mergedJSON, &updated)
+	if err != nil {
+		return errors.New(`error merging document: ` + err.Error())
+	}
+	updated.ID = id
+	backend.put(updated)
+	return nil
+}
+
+// score returns the IDs of the documents matching node and params with their
+// scores. The caller must hold the read lock.
+func (backend *MemoryBackend) score(node *queryNode, params types.SearchParams) map[string]float64 {
+	scores := make(map[string]float64)
+	searchFields := params.SearchFields
+	if len(searchFields) == 0 {
+		searchFields = DefaultSearchFields
+	}
+	emptyQuery := node.Clauses == nil && len(tokenize(node.Text)) == 0
+	now := time.Now()
+	for id, document := range backend.documents {
+		if !matchesFilters(document, params) {
+			continue
+		}
+		matched, score := true, 0.0
+		if !emptyQuery {
+			matched, score = backend.match(node, document, searchFields)
+		} else if params.Recency != nil {
+			// As with match_all, every document scores 1 before boosting.
+			score = 1
+		}
+		if !matched {
+			continue
+		}
+		if params.Recency != nil {
+			score *= recencyFactor(document, params.Recency, now)
+		}
+		scores[id] = score
+	}
+	return scores
+}
+
+// match returns whether document matches node, with the semantics of the
+// bool query built by queryNode.clause, and its score.
+func (backend *MemoryBackend) match(node *queryNode, document types.Document, searchFields []string) (bool, float64) {
+	if node.Clauses != nil {
+		score := 0.0
+		required, optional, matchedOptional := false, false, false
+		for _, clause := range node.Clauses {
+			matched, clauseScore := backend.match(clause.Node, document, searchFields)
+			switch clause.Occur {
+			case occurMust:
+				if !matched {
+					return false, 0
+				}
+				required = true
+				score += clauseScore
+			case occurMustNot:
+				if matched {
+					return false, 0
+				}
+			default:
+				optional = true
+				if matched {
+					matchedOptional = true
+					score += clauseScore
+				}
+			}
+		}
+		if optional && !required && !matchedOptional {
+			return false, 0
+		}
+		return true, score
+	}
+	if node.Field != `` {
+		score := backend.fieldScore(node, document, node.Field)
+		return score > 0, score
+	}
+	score := 0.0
+	for _, searchField := range searchFields {
+		field, boost := splitBoost(searchField)
+		score += boost * backend.fieldScore(node, document, field)
+	}
+	return score > 0, score
+}
+
+// fieldScore scores the text of node against one field of document: exact
+// values for keyword nodes, consecutive terms for phrases, and otherwise the
+// frequency of each term.
+func (backend *MemoryBackend) fieldScore(node *queryNode, document types.Document, field string) float64 {
+	score := 0.0
+	switch {
+	case node.Keyword:
+		for _, value := range documentFields(document)[field] {
+			if value == node.Text {
+				score++
+			}
+		}
+	case node.Phrase:
+		phrase := tokenize(node.Text)
+		if len(phrase) == 0 {
+			break
+		}
+		for _, value := range documentFields(document)[field] {
+			terms := tokenize(value)
+			for i := 0; i+len(phrase) <= len(terms); i++ {
+				if slices.Equal(terms[i:i+len(phrase)], phrase) {
+					score++
+				}
+			}
+		}
+	default:
+		for _, term := range tokenize(node.Text) {
+			score += float64(backend.terms[field][term][document.ID])
+		}
+	}
+	return score
+}
+
+// suggestions corrects the terms of params.Query that do not appear in the
+// suggest fields of any document the viewer may see. The caller must hold the
+// read lock.
+func (backend *MemoryBackend) suggestions(params types.SearchParams) []string {
+	vocabulary := map[string]int{}
+	for _, document := range backend.documents {
+		if !params.Viewer.CanView(document) {
+			continue
+		}
+		for _, text := range []string{document.Title, document.Description} {
+			for _, term := range tokenize(text) {
+				vocabulary[term]++
+			}
+		}
+	}
+	suggestion := correctTerms(tokenize(params.Query), vocabulary)
+	if suggestion == `` {
+		return nil
+	}
+	return []string{suggestion}
+}
+
+func matchesFilters(document types.Document, params types.SearchParams) bool {
+	if !params.Viewer.CanView(document) {
+		return false
+	}
+	fields := documentFields(document)
+	for field, values := range params.ExactMatch {
+		if len(values) > 0 && !hasAnyValue(fields[parentField(field)], values) {
+			return false
+		}
+	}
+	for field, values := range params.ExcludeMatch {
+		if hasAnyValue(fields[parentField(field)], values) {
+			return false
+		}
+	}
+	if params.StartDate != `` || params.EndDate != `` {
+		return inDateRange(firstFieldValue(document, dateField(params)), params, time.Now())
+	}
+	return true
+}
+
+// inDateRange returns whether date is within the date range of params. Dates
+// and bounds that cannot be parsed never match.
+func inDateRange(date string, params types.SearchParams, now time.Time) bool {
+	t, err := parseDateBound(date, now, false)
+	if date == `` || err != nil {
+		return false
+	}
+	if params.StartDate != `` {
+		start, err := parseDateBound(params.StartDate, now, false)
+		if err != nil || t.Before(start) {
+			return false
+		}
+	}
+	if params.EndDate != `` {
+		end, err := parseDateBound(params.EndDate, now, true)
+		if err != nil || t.After(end) {
+			return false
+		}
+	}
+	return true
+}
+
+func hasAnyValue(fieldValues []string, values []string) bool {
+	for _, fieldValue := range fieldValues {
+		if slices.Contains(values, fieldValue) {
+			return true
+		}
+	}
+	return false
+}
+
+func memoryHits(documents []types.Document, params types.SearchParams) []types.SearchHit {
+	hits := make([]types.SearchHit, 0, len(documents))
+	for _, document := range documents {
+		hit := types.SearchHit{Document: document}
+		if params.Highlight {
+			hit.Highlights = memoryHighlights(document, params)
+		}
+		if len(params.ReturnFields) > 0 {
+			hit.Document.FilterByJSON(params.ReturnFields)
+			hit.Document.ID = document.ID
+		}
+		hits = append(hits, hit)
+	}
+	return hits
+}
+
+func memoryFacets(documents []types.Document, facets []string) map[string][]types.FacetBucket {
+	if len(facets) == 0 {
+		return nil
+	}
+	result := make(map[string][]types.FacetBucket)
+	for _, facet := range facets {
+		if _, ok := facetAggregations[facet]; !ok {
+			continue
+		}
+		counts := map[string]int{}
+		for _, document := range documents {
+			if facet == `publication_year` {
+				if len(document.PublicationDate) >= 4 {
+					counts[document.PublicationDate[:4]]++
+				}
+				continue
+			}
+			for _, value := range documentFields(document)[facet] {
+				counts[value]++
+			}
+		}
+		buckets := make([]types.FacetBucket, 0, len(counts))
+		for value, count := range counts {
+			buckets = append(buckets, types.FacetBucket{Value: value, Count: int64(count)})
+		}
+		sort.Slice(buckets, func(i, j int) bool {
+			if facet == `publication_year` {
+				return buckets[i].Value < buckets[j].Value
+			}
+			if buckets[i].Count != buckets[j].Count {
+				return buckets[i].Count > buckets[j].Count
+			}
+			return buckets[i].Value < buckets[j].Value
+		})
+		if len(buckets) > facetSize {
+			buckets = buckets[:facetSize]
+		}
+		result[facet] = buckets
+	}
+	return result
+}
+
+// memoryHighlights wraps the query terms found in each highlighted field in
+// <em> tags, returning the whole field value as a single fragment.
+func memoryHighlights(document types.Document, params types.SearchParams) map[string][]string {
+	queryTerms := tokenize(params.Query)
+	if len(queryTerms) == 0 {
+		return nil
+	}
+	highlightFields := params.HighlightFields
+	if len(highlightFields) == 0 {
+		highlightFields = HighlightFields
+	}
+	fields := documentFields(document)
+	highlights := make(map[string][]string)
+	for _, field := range highlightFields {
+		for _, value := range fields[field] {
+			words := strings.Fields(value)
+			matched := false
+			for i, word := range words {
+				for _, term := range tokenize(word) {
+					if containsTerm(queryTerms, term, false) {
+						words[i] = `<em>` + word + `</em>`
+						matched = true
+						break
+					}
+				}
+			}
+			if matched {
+				highlights[field] = append(highlights[field], strings.Join(words, ` `))
+			}
+		}
+	}
+	if len(highlights) == 0 {
+		return nil
+	}
+	return highlights
+}
+
+// documentFields flattens document into its string values keyed by dotted
+// JSON path, eg. contributors.username.
+func documentFields(document types.Document) map[string][]string {
+	var fields map[string]interface{}
+	documentJSON, _ := json.Marshal(document)
+	json.Unmarshal(documentJSON, &fields)
+	flattened := make(map[string][]string)
+	flattenValues(fields, ``, flattened)
+	return flattened
+}
+
+func flattenValues(value interface{}, path string, flattened map[string][]string) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			childPath := key
+			if path != `` {
+				childPath = path + `.` + key
+			}
+			flattenValues(child, childPath, flattened)
+		}
+	case []interface{}:
+		for _, child := range v {
+			flattenValues(child, path, flattened)
+		}
+	case string:
+		flattened[path] = append(flattened[path], v)
+	case nil:
+	default:
+		flattened[path] = append(flattened[path], fmt.Sprint(v))
+	}
+}
+
+// sortValue returns the value of field that document is sorted by.
+func sortValue(document types.Document, field string) string {
+	return firstFieldValue(document, parentField(field))
+}
+
+// parentField returns the document field that field indexes. Multi-fields
+// such as title.keyword index the value of their parent field.
+func parentField(field string) string {
+	if parent, found := strings.CutSuffix(field, ".keyword"); found {
+		return parent
+	}
+	return field
+}
+
+func firstFieldValue(document types.Document, field string) string {
+	values := documentFields(document)[field]
+	if len(values) == 0 {
+		return ``
+	}
+	return values[0]
+}
+
+// tokenize splits text into lowercased terms of letters and digits.
+func tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+func containsTerm(terms []string, term string, prefix bool) bool {
+	for _, t := range terms {
+		if t == term || (prefix && strings.HasPrefix(t, term)) {
+			return true
+		}
+	}
+	return false
+}
+
+// splitBoost splits a search field such as title^3 into its name and boost.
+func splitBoost(searchField string) (string, float64) {
+	field, boostString, found := strings.Cut(searchField, `^`)
+	if !found {
+		return field, 1
+	}
+	boost, err := strconv.ParseFloat(boostString, 64)
+	if err != nil {
+		return field, 1
+	}
+	return field, boost
+}
@@ -0,0 +1,540 @@
+package search
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/MESH-Research/commons-connect/cc-search/types"
+)
+
+func memoryTestBackend(t *testing.T) *MemoryBackend {
+	backend := NewMemoryBackend("test")
+	documents := []types.Document{
+		{
+			Title:           "Searching Openly",
+			Description:     "An essay about open search",
+			Contributors:    []types.User{{Name: "Mike Thicke", Username: "mthicke"}},
+			PublicationDate: "2014-05-01",
+			ContentType:     "article",
+			NetworkNode:     "hc",
+		},
+		{
+			Title:           "Open Access Publishing",
+			Content:         "Searching for open access journals",
+			Contributors:    []types.User{{Name: "Jane Doe", Username: "jdoe"}},
+			PublicationDate: "2020-01-15",
+			ContentType:     "book",
+			NetworkNode:     "mla",
+		},
+		{
+			Title:           "Medieval Manuscripts",
+			Description:     "Catalogue of manuscripts",
+			PublicationDate: "2020-11-30",
+			ContentType:     "article",
+			NetworkNode:     "hc",
+		},
+	}
+	results, err := backend.BulkIndexDocuments(context.Background(), documents)
+	if err != nil {
+		t.Fatalf("Error indexing documents: %v", err)
+	}
+	for _, result := range results {
+		if !result.Succeeded() {
+			t.Fatalf("Expected document %d to be indexed, got status %d", result.Index, result.Status)
+		}
+	}
+	return backend
+}
+
+func TestMemoryBackendDocuments(t *testing.T) {
+	ctx := context.Background()
+	backend := NewMemoryBackend("test")
+
+	indexed, err := backend.IndexDocument(ctx, types.Document{Title: "Searching Openly"})
+	if err != nil {
+		t.Fatalf("Error indexing document: %v", err)
+	}
+	if indexed.ID == "" {
+		t.Fatal("Expected non-empty ID, got empty")
+	}
+
+	err = backend.UpdateDocument(ctx, types.Document{ID: indexed.ID, Title: "Searching Openly", Language: "en"})
+	if err != nil {
+		t.Fatalf("Error updating document: %v", err)
+	}
+	document, err := backend.GetDocument(ctx, indexed.ID)
+	if err != nil {
+		t.Fatalf("Error getting document: %v", err)
+	}
+	if document.Language != "en" || document.Title != "Searching Openly" {
+		t.Errorf("Expected updated document, got %+v", document)
+	}
+
+	err = backend.UpdateDocument(ctx, types.Document{ID: indexed.ID, Description: "A revised description"})
+	if err != nil {
+		t.Fatalf("Error updating document: %v", err)
+	}
+	document, _ = backend.GetDocument(ctx, indexed.ID)
+	if document.Title != "Searching Openly" || document.Description != "A revised description" {
+		t.Errorf("Expected update without a title to keep the title, got %+v", document)
+	}
+
+	err = backend.DeleteDocument(ctx, indexed.ID)
+	if err != nil {
+		t.Fatalf("Error deleting document: %v", err)
+	}
+	if _, err := backend.GetDocument(ctx, indexed.ID); err == nil {
+		t.Error("Expected error getting deleted document, got nil")
+	}
+	count, _ := backend.CountDocuments(ctx)
+	if count != 0 {
+		t.Errorf("Expected 0 documents, got %d", count)
+	}
+}
+
+func TestMemoryBackendUpsert(t *testing.T) {
+	ctx := context.Background()
+	backend := NewMemoryBackend("test")
+	document := types.Document{Title: "First", NetworkNode: "hc", InternalID: "42"}
+
+	first, created, err := backend.UpsertDocument(ctx, document)
+	if err != nil || !created {
+		t.Fatalf("Expected document to be created, got created=%v err=%v", created, err)
+	}
+	document.Title = "Second"
+	second, created, err := backend.UpsertDocument(ctx, document)
+	if err != nil || created {
+		t.Fatalf("Expected document to be replaced, got created=%v err=%v", created, err)
+	}
+	if first.ID != second.ID || first.ID != DocumentID("hc", "42") {
+		t.Errorf("Expected ID %s for both upserts, got %s and %s", DocumentID("hc", "42"), first.ID, second.ID)
+	}
+	response, _ := backend.Search(ctx, types.SearchParams{Query: "first"})
+	if response.Total != 0 {
+		t.Errorf("Expected replaced title to be removed from the index, got %d hits", response.Total)
+	}
+}
+
+func TestMemoryBackendSearch(t *testing.T) {
+	ctx := context.Background()
+	backend := memoryTestBackend(t)
+
+	tests := []struct {
+		name   string
+		params types.SearchParams
+		titles []string
+	}{
+		{
+			"title matches rank above content matches",
+			types.SearchParams{Query: "searching"},
+			[]string{"Searching Openly", "Open Access Publishing"},
+		},
+		{
+			"search fields",
+			types.SearchParams{Query: "searching", SearchFields: []string{"content"}},
+			[]string{"Open Access Publishing"},
+		},
+		{
+			"exact match",
+			types.SearchParams{Query: "open", ExactMatch: map[string][]string{"contributors.username": {"jdoe"}}},
+			[]string{"Open Access Publishing"},
+		},
+		{
+			"phrase",
+			types.SearchParams{Query: `"open access"`},
+			[]string{"Open Access Publishing"},
+		},
+		{
+			"excluded word",
+			types.SearchParams{Query: "open -journals"},
+			[]string{"Searching Openly"},
+		},
+		{
+			"field prefix",
+			types.SearchParams{Query: `author:"Jane Doe"`},
+			[]string{"Open Access Publishing"},
+		},
+		{
+			"boolean operators",
+			types.SearchParams{Query: "(manuscripts OR journals) AND NOT network_node:mla"},
+			[]string{"Medieval Manuscripts"},
+		},
+		{
+			"exact match with several values",
+			types.SearchParams{ExactMatch: map[string][]string{"content_type": {"book", "chapter"}}},
+			[]string{"Open Access Publishing"},
+		},
+		{
+			"exact match on a multi-field",
+			types.SearchParams{ExactMatch: map[string][]string{"title.keyword": {"Searching Openly"}}},
+			[]string{"Searching Openly"},
+		},
+		{
+			"excluded exact match",
+			types.SearchParams{
+				ExcludeMatch: map[string][]string{"network_node": {"mla"}, "contributors.username": {"mthicke"}},
+			},
+			[]string{"Medieval Manuscripts"},
+		},
+		{
+			"date range",
+			types.SearchParams{StartDate: "2020-01-01", EndDate: "2020-06-30"},
+			[]string{"Open Access Publishing"},
+		},
+		{
+			"sort",
+			types.SearchParams{Sort: []types.SortKey{{Field: "publication_date", Direction: "desc"}}},
+			[]string{"Medieval Manuscripts", "Open Access Publishing", "Searching Openly"},
+		},
+		{
+			"multi-field sort",
+			types.SearchParams{Sort: []types.SortKey{{Field: "content_type", Direction: "asc"}, {Field: "publication_date", Direction: "desc"}}},
+			[]string{"Medieval Manuscripts", "Searching Openly", "Open Access Publishing"},
+		},
+		{
+			"title sort",
+			types.SearchParams{Sort: []types.SortKey{{Field: "title.keyword", Direction: "asc"}}},
+			[]string{"Medieval Manuscripts", "Open Access Publishing", "Searching Openly"},
+		},
+		{
+			"pagination",
+			types.SearchParams{Sort: []types.SortKey{{Field: "publication_date", Direction: "asc"}}, Page: 2, PerPage: 2},
+			[]string{"Medieval Manuscripts"},
+		},
+	}
+	for _, tt := range tests {
+		response, err := backend.Search(ctx, tt.params)
+		if err != nil {
+			t.Fatalf("%s: error searching: %v", tt.name, err)
+		}
+		titles := []string{}
+		for _, hit := range response.Hits {
+			titles = append(titles, hit.Title)
+		}
+		if len(titles) != len(tt.titles) {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.titles, titles)
+			continue
+		}
+		for i := range titles {
+			if titles[i] != tt.titles[i] {
+				t.Errorf("%s: expected %v, got %v", tt.name, tt.titles, titles)
+				break
+			}
+		}
+	}
+}
+
+func TestMemoryBackendDateRange(t *testing.T) {
+	ctx := context.Background()
+	backend := NewMemoryBackend("test")
+	backend.BulkIndexDocuments(ctx, []types.Document{
+		{Title: "Recently Changed", PublicationDate: "2019-06-01", ModifiedDate: time.Now().Add(-48 * time.Hour).Format(time.RFC3339)},
+		{Title: "Unchanged", PublicationDate: "2020-06-01", ModifiedDate: "2020-06-01"},
+		{Title: "Never Changed", PublicationDate: "2021-06-01"},
+	})
+
+	tests := []struct {
+		params types.SearchParams
+		total  int64
+	}{
+		{types.SearchParams{StartDate: "now-7d", DateField: "modified_date"}, 1},
+		{types.SearchParams{EndDate: "now-7d", DateField: "modified_date"}, 1},
+		{types.SearchParams{StartDate: "2020-06-01T00:00:00Z", DateField: "modified_date"}, 2},
+		{types.SearchParams{StartDate: "2020", EndDate: "2020"}, 1},
+		{types.SearchParams{EndDate: "2020-05"}, 1},
+		{types.SearchParams{StartDate: "2020-06-01T00:00:01+02:00"}, 2},
+	}
+	for _, tt := range tests {
+		response, err := backend.Search(ctx, tt.params)
+		if err != nil {
+			t.Fatalf("Error searching: %v", err)
+		}
+		if response.Total != tt.total {
+			t.Errorf("%s to %s on %s: expected %d hits, got %d", tt.params.StartDate, tt.params.EndDate, tt.params.DateField, tt.total, response.Total)
+		}
+	}
+}
+
+func TestMemoryBackendRecency(t *testing.T) {
+	ctx := context.Background()
+	backend := NewMemoryBackend("test")
+	backend.BulkIndexDocuments(ctx, []types.Document{
+		{Title: "Open Access Open Science", PublicationDate: "2012-01-01"},
+		{Title: "Open Access", PublicationDate: time.Now().Format("2006-01-02")},
+		{Title: "Undated"},
+	})
+	titles := func(params types.SearchParams) []string {
+		response, err := backend.Search(ctx, params)
+		if err != nil {
+			t.Fatalf("Error searching: %v", err)
+		}
+		titles := []string{}
+		for _, hit := range response.Hits {
+			titles = append(titles, hit.Title)
+		}
+		return titles
+	}
+	recency := &types.RecencyBoost{Scale: "365d", Weight: 2}
+
+	if result := titles(types.SearchParams{Query: "open"}); result[0] != "Open Access Open Science" {
+		t.Errorf("Expected the more relevant document first, got %v", result)
+	}
+	if result := titles(types.SearchParams{Query: "open", Recency: recency}); result[0] != "Open Access" {
+		t.Errorf("Expected the recent document first, got %v", result)
+	}
+	if result := titles(types.SearchParams{Recency: recency}); len(result) != 3 || result[0] != "Open Access" {
+		t.Errorf("Expected all documents, the recent one first, got %v", result)
+	}
+}
+
+func TestMemoryBackendQuerySyntaxError(t *testing.T) {
+	backend := memoryTestBackend(t)
+	_, err := backend.Search(context.Background(), types.SearchParams{Query: "open AND (access"})
+	var syntaxError *QuerySyntaxError
+	if !errors.As(err, &syntaxError) || syntaxError.Position != 9 {
+		t.Errorf("Expected syntax error at position 9, got %v", err)
+	}
+}
+
+func TestMemoryBackendFacetsAndHighlights(t *testing.T) {
+	backend := memoryTestBackend(t)
+	response, err := backend.Search(context.Background(), types.SearchParams{
+		Query:     "manuscripts",
+		Facets:    []string{"content_type", "publication_year"},
+		Highlight: true,
+	})
+	if err != nil {
+		t.Fatalf("Error searching: %v", err)
+	}
+	if len(response.Hits) != 1 {
+		t.Fatalf("Expected 1 hit, got %d", len(response.Hits))
+	}
+	if got := response.Hits[0].Highlights["title"]; len(got) != 1 || got[0] != "Medieval <em>Manuscripts</em>" {
+		t.Errorf("Expected highlighted title, got %v", got)
+	}
+	if got := response.Facets["content_type"]; len(got) != 1 || got[0].Value != "article" || got[0].Count != 1 {
+		t.Errorf("Expected one article bucket, got %v", got)
+	}
+
+	response, _ = backend.Search(context.Background(), types.SearchParams{Facets: []string{"publication_year"}})
+	years := response.Facets["publication_year"]
+	if len(years) != 2 || years[0].Value != "2014" || years[1].Value != "2020" || years[1].Count != 2 {
+		t.Errorf("Expected 2014 and 2020 buckets, got %v", years)
+	}
+}
+
+func TestMemoryBackendCursor(t *testing.T) {
+	ctx := context.Background()
+	backend := memoryTestBackend(t)
+	params := types.SearchParams{Cursor: CursorStart, PerPage: 2, Sort: []types.SortKey{{Field: "publication_date", Direction: "asc"}}}
+
+	seen := []string{}
+	for page := 0; page < 3; page++ {
+		response, err := backend.Search(ctx, params)
+		if err != nil {
+			t.Fatalf("Error searching: %v", err)
+		}
+		for _, hit := range response.Hits {
+			seen = append(seen, hit.Title)
+		}
+		if response.Cursor == "" {
+			break
+		}
+		params.Cursor = response.Cursor
+	}
+	if len(seen) != 3 || seen[0] != "Searching Openly" || seen[2] != "Medieval Manuscripts" {
+		t.Errorf("Expected all documents in date order, got %v", seen)
+	}
+
+	params.Sort = []types.SortKey{{Field: "title.keyword", Direction: "asc"}}
+	_, err := backend.Search(ctx, params)
+	if !errors.Is(err, ErrInvalidCursor) {
+		t.Errorf("Expected ErrInvalidCursor for a different sort, got %v", err)
+	}
+}
+
+func TestMemoryBackendTypeAhead(t *testing.T) {
+	backend := memoryTestBackend(t)
+	documents, err := backend.TypeAheadSearch(context.Background(), "open acc", nil)
+	if err != nil {
+		t.Fatalf("Error searching: %v", err)
+	}
+	if len(documents) != 1 || documents[0].Title != "Open Access Publishing" {
+		t.Errorf("Expected Open Access Publishing, got %v", documents)
+	}
+	if documents[0].Content != "" {
+		t.Errorf("Expected only typeahead fields, got content %q", documents[0].Content)
+	}
+}
+
+func TestMemoryBackendBulk(t *testing.T) {
+	ctx := context.Background()
+	backend := memoryTestBackend(t)
+	response, _ := backend.Search(ctx, types.SearchParams{ExactMatch: map[string][]string{"network_node": {"hc"}}})
+	if response.Total != 2 {
+		t.Fatalf("Expected 2 hc documents, got %d", response.Total)
+	}
+	id := response.Hits[0].ID
+
+	results, err := backend.BulkUpdateDocuments(ctx, []types.Document{
+		{ID: id, Title: "Renamed"},
+		{ID: "missing", Title: "Missing"},
+	})
+	if err != nil {
+		t.Fatalf("Error updating documents: %v", err)
+	}
+	if results[0].Status != 200 || results[1].Status != 404 {
+		t.Errorf("Expected statuses 200 and 404, got %d and %d", results[0].Status, results[1].Status)
+	}
+
+	results, err = backend.BulkDeleteDocuments(ctx, []string{id, "missing"})
+	if err != nil {
+		t.Fatalf("Error deleting documents: %v", err)
+	}
+	if results[0].Status != 200 || results[1].Status != 404 {
+		t.Errorf("Expected statuses 200 and 404, got %d and %d", results[0].Status, results[1].Status)
+	}
+
+	err = backend.DeleteNode(ctx, "hc")
+	if err != nil {
+		t.Fatalf("Error deleting node: %v", err)
+	}
+	count, _ := backend.CountDocuments(ctx)
+	if count != 1 {
+		t.Errorf("Expected 1 document left, got %d", count)
+	}
+}
+
+func TestMemoryBackendIndexInfo(t *testing.T) {
+	ctx := context.Background()
+	backend := memoryTestBackend(t)
+	info, err := backend.GetIndexInfo(ctx)
+	if err != nil {
+		t.Fatalf("Error getting index info: %v", err)
+	}
+	drift, err := IndexMappingDrift(info)
+	if err != nil {
+		t.Fatalf("Error comparing mappings: %v", err)
+	}
+	for index, indexDrift := range drift {
+		if !indexDrift.InSync {
+			t.Errorf("Expected %s to match the embedded settings, got %+v", index, indexDrift)
+		}
+	}
+
+	result, err := backend.Reindex(ctx)
+	if err != nil {
+		t.Fatalf("Error reindexing: %v", err)
+	}
+	if result.Documents != 3 {
+		t.Errorf("Expected 3 documents reindexed, got %d", result.Documents)
+	}
+	err = backend.ResetIndex(ctx)
+	if err != nil {
+		t.Fatalf("Error resetting index: %v", err)
+	}
+	count, _ := backend.CountDocuments(ctx)
+	if count != 0 {
+		t.Errorf("Expected empty index after reset, got %d documents", count)
+	}
+}
+
+func TestMemoryBackendVisibility(t *testing.T) {
+	ctx := context.Background()
+	backend := NewMemoryBackend("test")
+	results, err := backend.BulkIndexDocuments(ctx, []types.Document{
+		{Title: "Open Notes"},
+		{Title: "Members Notes", Visibility: types.VisibilityMembers},
+		{Title: "Editors Notes", Visibility: types.VisibilityPrivate, AllowedGroups: []string{"editors"}},
+		{Title: "Personal Notes", Visibility: types.VisibilityPrivate, Owner: types.User{Username: "jdoe"}},
+	})
+	if err != nil {
+		t.Fatalf("Error indexing documents: %v", err)
+	}
+
+	tests := []struct {
+		viewer *types.Viewer
+		total  int64
+	}{
+		{nil, 4},
+		{&types.Viewer{}, 1},
+		{&types.Viewer{Username: "asmith"}, 2},
+		{&types.Viewer{Username: "asmith", Groups: []string{"editors"}}, 3},
+		{&types.Viewer{Username: "jdoe"}, 3},
+	}
+	for _, tt := range tests {
+		response, err := backend.Search(ctx, types.SearchParams{Query: "notes", Viewer: tt.viewer})
+		if err != nil {
+			t.Fatalf("Error searching: %v", err)
+		}
+		if response.Total != tt.total {
+			t.Errorf("%+v: expected %d hits, got %d", tt.viewer, tt.total, response.Total)
+		}
+		documents, _ := backend.TypeAheadSearch(ctx, "notes", tt.viewer)
+		if int64(len(documents)) != tt.total {
+			t.Errorf("%+v: expected %d typeahead results, got %d", tt.viewer, tt.total, len(documents))
+		}
+	}
+
+	// Updating allowed_groups to an empty list revokes the group's access.
+	err = backend.UpdateDocument(ctx, types.Document{ID: results[2].ID, AllowedGroups: []string{}})
+	if err != nil {
+		t.Fatalf("Error updating document: %v", err)
+	}
+	editor := &types.Viewer{Username: "asmith", Groups: []string{"editors"}}
+	response, _ := backend.Search(ctx, types.SearchParams{Query: "notes", Viewer: editor})
+	if response.Total != 2 {
+		t.Errorf("Expected 2 hits after revoking access, got %d", response.Total)
+	}
+}
+
+func TestMemoryBackendRelated(t *testing.T) {
+	ctx := context.Background()
+	backend := memoryTestBackend(t)
+	source, _ := backend.IndexDocument(ctx, types.Document{Title: "An essay on open search", NetworkNode: "mla"})
+
+	response, err := backend.RelatedDocuments(ctx, source.ID, types.SearchParams{})
+	if err != nil {
+		t.Fatalf("Error finding related documents: %v", err)
+	}
+	if response.Total != 2 || response.Hits[0].Title != "Searching Openly" {
+		t.Errorf("Expected Searching Openly first of 2 hits, got %+v", response.Hits)
+	}
+
+	response, _ = backend.RelatedDocuments(ctx, source.ID, types.SearchParams{ExactMatch: map[string][]string{"network_node": {"mla"}}})
+	if response.Total != 1 || response.Hits[0].Title != "Open Access Publishing" {
+		t.Errorf("Expected only Open Access Publishing, got %+v", response.Hits)
+	}
+
+	if _, err := backend.RelatedDocuments(ctx, "missing", types.SearchParams{}); err == nil {
+		t.Error("Expected error for a missing document, got nil")
+	}
+}
+
+func TestMemoryBackendSuggestions(t *testing.T) {
+	ctx := context.Background()
+	backend := memoryTestBackend(t)
+	backend.IndexDocument(ctx, types.Document{Title: "Hidden Palimpsests", Visibility: types.VisibilityPrivate})
+
+	response, _ := backend.Search(ctx, types.SearchParams{Query: "medeival", SuggestThreshold: 3})
+	if len(response.Suggestions) != 1 || response.Suggestions[0] != "medieval" {
+		t.Errorf("Expected suggestion medieval, got %v", response.Suggestions)
+	}
+
+	response, _ = backend.Search(ctx, types.SearchParams{Query: "manuscripts", SuggestThreshold: 3})
+	if response.Suggestions != nil {
+		t.Errorf("Expected no suggestions for a correct query, got %v", response.Suggestions)
+	}
+
+	response, _ = backend.Search(ctx, types.SearchParams{Query: "medeival"})
+	if response.Suggestions != nil {
+		t.Errorf("Expected no suggestions without a threshold, got %v", response.Suggestions)
+	}
+
+	response, _ = backend.Search(ctx, types.SearchParams{Query: "palimpsets", Suggest: true, Viewer: &types.Viewer{}})
+	if response.Suggestions != nil {
+		t.Errorf("Expected no suggestions from hidden documents, got %v", response.Suggestions)
+	}
+}
@@ -0,0 +1,201 @@
+package search
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+
+	"github.com/MESH-Research/commons-connect/cc-search/types"
+)
+
+// Fields returned by typeahead searches.
+var typeAheadFields = []string{"title", "primary_url", "other_urls"}
+
+// Number of results returned by typeahead searches.
+const typeAheadSize = 5
+
+// queryData is the body of a request using the OpenSearch query DSL. Every
+// query sent by this package is built from these types and marshalled with
+// encoding/json, so user input only ever appears as an escaped JSON string
+// value and cannot change the structure of a query.
+type queryData struct {
+	From        int                      `json:"from,omitempty"`
+	Size        int                      `json:"size,omitempty"`
+	Fields      []string                 `json:"fields,omitempty"`
+	Sort        []map[string]interface{} `json:"sort,omitempty"`
+	SearchAfter []json.RawMessage        `json:"search_after,omitempty"`
+	PIT         *pointInTime             `json:"pit,omitempty"`
+	Aggs        map[string]interface{}   `json:"aggs,omitempty"`
+	Highlight   *highlightData           `json:"highlight,omitempty"`
+	Suggest     map[string]interface{}   `json:"suggest,omitempty"`
+	Query       struct {
+		Bool struct {
+			Must    []interface{} `json:"must,omitempty"`
+			Filter  []interface{} `json:"filter,omitempty"`
+			MustNot []interface{} `json:"must_not,omitempty"`
+		} `json:"bool,omitempty"`
+	} `json:"query"`
+}
+
+type multiMatchQuery struct {
+	MultiMatch struct {
+		Query     string   `json:"query"`
+		Type      string   `json:"type,omitempty"`
+		Fields    []string `json:"fields,omitempty"`
+		Fuzziness string   `json:"fuzziness,omitempty"`
+	} `json:"multi_match,omitempty"`
+}
+
+type termQuery struct {
+	Term map[string]termValue `json:"term"`
+}
+
+type termValue struct {
+	Value string `json:"value"`
+}
+
+type termsQuery struct {
+	Terms map[string][]string `json:"terms"`
+}
+
+type existsQuery struct {
+	Exists struct {
+		Field string `json:"field"`
+	} `json:"exists"`
+}
+
+// boolQuery is a bool query nested inside another query.
+type boolQuery struct {
+	Bool struct {
+		Must               []interface{} `json:"must,omitempty"`
+		Should             []interface{} `json:"should,omitempty"`
+		MustNot            []interface{} `json:"must_not,omitempty"`
+		MinimumShouldMatch int           `json:"minimum_should_match,omitempty"`
+	} `json:"bool"`
+}
+
+// dateQuery is a range query on a date field, keyed by the field.
+type dateQuery struct {
+	Range map[string]dateRange `json:"range"`
+}
+
+type dateRange struct {
+	GTE string `json:"gte,omitempty"`
+	LTE string `json:"lte,omitempty"`
+}
+
+func newMultiMatchQuery(query string, fields ...string) multiMatchQuery {
+	multiMatch := multiMatchQuery{}
+	multiMatch.MultiMatch.Query = query
+	multiMatch.MultiMatch.Fields = fields
+	return multiMatch
+}
+
+func newTermQuery(field string, value string) termQuery {
+	return termQuery{
+		Term: map[string]termValue{
+			field: {Value: value},
+		},
+	}
+}
+
+// exactMatchQuery matches documents whose field has any of values.
+func exactMatchQuery(field string, values []string) interface{} {
+	if len(values) == 1 {
+		return newTermQuery(field, values[0])
+	}
+	return termsQuery{Terms: map[string][]string{field: values}}
+}
+
+// addExactMatches adds params.ExactMatch to the filters of queryData and
+// params.ExcludeMatch to its must_not clauses. Neither affects scoring.
+func (queryData *queryData) addExactMatches(params types.SearchParams) {
+	for field, values := range params.ExactMatch {
+		if len(values) > 0 {
+			queryData.Query.Bool.Filter = append(queryData.Query.Bool.Filter, exactMatchQuery(field, values))
+		}
+	}
+	for field, values := range params.ExcludeMatch {
+		if len(values) > 0 {
+			queryData.Query.Bool.MustNot = append(queryData.Query.Bool.MustNot, exactMatchQuery(field, values))
+		}
+	}
+}
+
+func newExistsQuery(field string) existsQuery {
+	exists := existsQuery{}
+	exists.Exists.Field = field
+	return exists
+}
+
+// visibilityQuery matches the documents viewer may see, as decided by
+// types.Viewer.CanView. Documents indexed before visibility was added have no
+// visibility and are public.
+func visibilityQuery(viewer *types.Viewer) boolQuery {
+	noVisibility := boolQuery{}
+	noVisibility.Bool.MustNot = []interface{}{newExistsQuery("visibility")}
+
+	query := boolQuery{}
+	query.Bool.MinimumShouldMatch = 1
+	query.Bool.Should = []interface{}{
+		newTermQuery("visibility", types.VisibilityPublic),
+		noVisibility,
+	}
+	if viewer.Username != "" {
+		query.Bool.Should = append(
+			query.Bool.Should,
+			newTermQuery("visibility", types.VisibilityMembers),
+			newTermQuery("owner.username", viewer.Username),
+			newTermQuery("allowed_users", viewer.Username),
+		)
+		if len(viewer.Groups) > 0 {
+			query.Bool.Should = append(
+				query.Bool.Should,
+				termsQuery{Terms: map[string][]string{"allowed_groups": viewer.Groups}},
+			)
+		}
+	}
+	return query
+}
+
+// reader returns the JSON encoding of the query as a request body.
+func (queryData queryData) reader() io.Reader {
+	queryJSON, _ := json.Marshal(queryData)
+	return bytes.NewReader(queryJSON)
+}
+
+// basicSearchQuery matches query against all indexed fields.
+func basicSearchQuery(query string) queryData {
+	queryData := queryData{}
+	queryData.Query.Bool.Must = append(
+		queryData.Query.Bool.Must,
+		newMultiMatchQuery(query),
+	)
+	return queryData
+}
+
+// typeAheadQuery matches query as a prefix of the titles of documents viewer
+// may see.
+func typeAheadQuery(query string, viewer *types.Viewer) queryData {
+	queryData := queryData{
+		Fields: typeAheadFields,
+		Size:   typeAheadSize,
+	}
+	baseQuery := newMultiMatchQuery(query, "title")
+	baseQuery.MultiMatch.Type = "bool_prefix"
+	queryData.Query.Bool.Must = append(queryData.Query.Bool.Must, baseQuery)
+	if viewer != nil {
+		queryData.Query.Bool.Filter = append(queryData.Query.Bool.Filter, visibilityQuery(viewer))
+	}
+	return queryData
+}
+
+// deleteNodeQuery matches every document belonging to a network node.
+func deleteNodeQuery(node string) queryData {
+	queryData := queryData{}
+	queryData.Query.Bool.Must = append(
+		queryData.Query.Bool.Must,
+		newTermQuery("network_node", node),
+	)
+	return queryData
+}
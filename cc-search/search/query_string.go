@@ -0,0 +1,394 @@
+package search
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// The search query syntax, parsed by parseQueryString:
+//
+//	open access          either word, fuzzy, over the search fields
+//	"open access"        the exact phrase, over the search fields
+//	+open -draft         open is required and draft is excluded
+//	open AND access      both; AND binds more tightly than OR
+//	open OR access       either
+//	NOT draft            same as -draft
+//	(open OR free) AND access
+//	title:commons        a word or "phrase" in one field
+//
+// Operators must be upper case; lower case and, or and not are words. Words
+// with a colon that is not a known field prefix followed by a value, such as
+// `Commons: a history` or a URL, are words too.
+
+// Fields that can be searched with a field:value prefix, keyed by the name
+// used in queries. Text fields are matched like the search fields; keyword
+// fields must match exactly.
+var queryStringFields = map[string]queryStringField{
+	"title":                 {"title", false},
+	"description":           {"description", false},
+	"content":               {"content", false},
+	"owner.name":            {"owner.name", false},
+	"contributors.name":     {"contributors.name", false},
+	"author":                {"contributors.name", false},
+	"owner.username":        {"owner.username", true},
+	"contributors.username": {"contributors.username", true},
+	"username":              {"contributors.username", true},
+	"content_type":          {"content_type", true},
+	"network_node":          {"network_node", true},
+	"language":              {"language", true},
+}
+
+type queryStringField struct {
+	Field   string
+	Keyword bool
+}
+
+// Limits on parsed queries, so that a query cannot make an arbitrarily large
+// request to the cluster.
+const (
+	maxQueryDepth   = 8
+	maxQueryClauses = 64
+)
+
+// QuerySyntaxError is returned for a search query that cannot be parsed.
+type QuerySyntaxError struct {
+	Position int    // Byte offset in the query where the error was found
+	Reason   string // What is wrong
+}
+
+func (err *QuerySyntaxError) Error() string {
+	return fmt.Sprintf(`invalid query at position %d: %s`, err.Position, err.Reason)
+}
+
+type occur int
+
+const (
+	occurShould occur = iota
+	occurMust
+	occurMustNot
+)
+
+// queryNode is a parsed search query. A node with clauses combines them like
+// a bool query; otherwise it matches Text in Field, or in the search fields if
+// Field is empty.
+type queryNode struct {
+	Field   string
+	Keyword bool
+	Text    string
+	Phrase  bool
+	Clauses []queryClause
+}
+
+type queryClause struct {
+	Occur occur
+	Node  *queryNode
+}
+
+func textNode(text string) *queryNode {
+	return &queryNode{Text: text}
+}
+
+type tokenKind int
+
+const (
+	tokenWord tokenKind = iota
+	tokenPhrase
+	tokenField
+	tokenAnd
+	tokenOr
+	tokenNot
+	tokenPlus
+	tokenMinus
+	tokenOpen
+	tokenClose
+	tokenEnd
+)
+
+type queryToken struct {
+	Kind     tokenKind
+	Text     string
+	Position int
+}
+
+var fieldPrefixPattern = regexp.MustCompile(`^([A-Za-z_][A-Za-z0-9_.]*):`)
+
+func tokenizeQuery(query string) ([]queryToken, error) {
+	tokens := []queryToken{}
+	i := 0
+	for i < len(query) {
+		switch c := query[i]; {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '(':
+			tokens = append(tokens, queryToken{tokenOpen, `(`, i})
+			i++
+		case c == ')':
+			tokens = append(tokens, queryToken{tokenClose, `)`, i})
+			i++
+		case c == '"':
+			end := strings.IndexByte(query[i+1:], '"')
+			if end < 0 {
+				return nil, &QuerySyntaxError{i, `unterminated quoted phrase`}
+			}
+			tokens = append(tokens, queryToken{tokenPhrase, query[i+1 : i+1+end], i})
+			i += end + 2
+		case (c == '-' || c == '+') && i+1 < len(query) && !strings.ContainsRune(" \t\n\r)", rune(query[i+1])):
+			kind := tokenPlus
+			if c == '-' {
+				kind = tokenMinus
+			}
+			tokens = append(tokens, queryToken{kind, string(c), i})
+			i++
+		default:
+			start := i
+			// Only a known field directly followed by a value is a field
+			// prefix. Other words with colons, such as `Commons: a history`
+			// or a URL, are searched as they are.
+			prefix := fieldPrefixPattern.FindString(query[i:])
+			_, known := queryStringFields[strings.TrimSuffix(prefix, `:`)]
+			if end := i + len(prefix); known && end < len(query) && !strings.ContainsRune(" \t\n\r()", rune(query[end])) {
+				tokens = append(tokens, queryToken{tokenField, prefix[:len(prefix)-1], i})
+				i = end
+				if query[i] == '"' {
+					continue
+				}
+				start = i
+			}
+			for i < len(query) && !strings.ContainsRune(" \t\n\r()\"", rune(query[i])) {
+				i++
+			}
+			word := query[start:i]
+			kind := tokenWord
+			switch word {
+			case `AND`:
+				kind = tokenAnd
+			case `OR`:
+				kind = tokenOr
+			case `NOT`:
+				kind = tokenNot
+			}
+			if kind != tokenWord && len(tokens) > 0 && tokens[len(tokens)-1].Kind == tokenField {
+				kind = tokenWord
+			}
+			tokens = append(tokens, queryToken{kind, word, start})
+		}
+	}
+	return append(tokens, queryToken{tokenEnd, ``, len(query)}), nil
+}
+
+type queryParser struct {
+	tokens  []queryToken
+	next    int
+	depth   int
+	clauses int
+}
+
+// parseQueryString parses a search query. Queries without any syntax parse
+// to a single text node and are searched as before.
+func parseQueryString(query string) (*queryNode, error) {
+	tokens, err := tokenizeQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	parser := &queryParser{tokens: tokens}
+	if parser.peek().Kind == tokenEnd {
+		return textNode(``), nil
+	}
+	node, err := parser.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if token := parser.peek(); token.Kind != tokenEnd {
+		return nil, &QuerySyntaxError{token.Position, `unexpected ` + describeToken(token)}
+	}
+	return node, nil
+}
+
+func (parser *queryParser) peek() queryToken {
+	return parser.tokens[parser.next]
+}
+
+func (parser *queryParser) advance() queryToken {
+	token := parser.tokens[parser.next]
+	if token.Kind != tokenEnd {
+		parser.next++
+	}
+	return token
+}
+
+func describeToken(token queryToken) string {
+	switch token.Kind {
+	case tokenEnd:
+		return `end of query`
+	case tokenPhrase:
+		return `phrase "` + token.Text + `"`
+	}
+	return `"` + token.Text + `"`
+}
+
+// Combines nodes with occur, or returns the only node.
+func combine(nodes []*queryNode, occur occur) *queryNode {
+	if len(nodes) == 1 {
+		return nodes[0]
+	}
+	combined := &queryNode{}
+	for _, node := range nodes {
+		combined.Clauses = append(combined.Clauses, queryClause{occur, node})
+	}
+	return combined
+}
+
+// or := and (OR and)*
+func (parser *queryParser) parseOr() (*queryNode, error) {
+	nodes := []*queryNode{}
+	for {
+		node, err := parser.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, node)
+		if parser.peek().Kind != tokenOr {
+			return combine(nodes, occurShould), nil
+		}
+		parser.advance()
+	}
+}
+
+// and := sequence (AND sequence)*
+func (parser *queryParser) parseAnd() (*queryNode, error) {
+	nodes := []*queryNode{}
+	for {
+		node, err := parser.parseSequence()
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, node)
+		if parser.peek().Kind != tokenAnd {
+			return combine(nodes, occurMust), nil
+		}
+		parser.advance()
+	}
+}
+
+// sequence := ((+|-|NOT)? primary)+
+//
+// Clauses without a modifier are optional, as in a bool query's should, but
+// at least one must match unless the sequence has required clauses. Adjacent
+// words are searched together.
+func (parser *queryParser) parseSequence() (*queryNode, error) {
+	sequence := &queryNode{}
+	for {
+		token := parser.peek()
+		occur := occurShould
+		switch token.Kind {
+		case tokenOr, tokenAnd, tokenClose, tokenEnd:
+			if len(sequence.Clauses) == 0 {
+				return nil, &QuerySyntaxError{token.Position, `expected a search term before ` + describeToken(token)}
+			}
+			if len(sequence.Clauses) == 1 && sequence.Clauses[0].Occur == occurShould {
+				return sequence.Clauses[0].Node, nil
+			}
+			return sequence, nil
+		case tokenPlus:
+			occur = occurMust
+			parser.advance()
+		case tokenMinus, tokenNot:
+			occur = occurMustNot
+			parser.advance()
+		}
+		node, err := parser.parsePrimary()
+		if err != nil {
+			return nil, err
+		}
+		parser.clauses++
+		if parser.clauses > maxQueryClauses {
+			return nil, &QuerySyntaxError{token.Position, fmt.Sprintf(`more than %d search terms`, maxQueryClauses)}
+		}
+		last := len(sequence.Clauses) - 1
+		if occur == occurShould && isPlainWord(node) && last >= 0 &&
+			sequence.Clauses[last].Occur == occurShould && isPlainWord(sequence.Clauses[last].Node) {
+			sequence.Clauses[last].Node.Text += ` ` + node.Text
+			continue
+		}
+		sequence.Clauses = append(sequence.Clauses, queryClause{occur, node})
+	}
+}
+
+func isPlainWord(node *queryNode) bool {
+	return node.Clauses == nil && node.Field == `` && !node.Phrase
+}
+
+// primary := word | "phrase" | field:word | field:"phrase" | ( or )
+func (parser *queryParser) parsePrimary() (*queryNode, error) {
+	token := parser.advance()
+	switch token.Kind {
+	case tokenWord:
+		return textNode(token.Text), nil
+	case tokenPhrase:
+		if strings.TrimSpace(token.Text) == `` {
+			return nil, &QuerySyntaxError{token.Position, `empty phrase`}
+		}
+		return &queryNode{Text: token.Text, Phrase: true}, nil
+	case tokenField:
+		field := queryStringFields[token.Text]
+		value := parser.advance()
+		if value.Kind == tokenPhrase && strings.TrimSpace(value.Text) == `` {
+			return nil, &QuerySyntaxError{value.Position, `empty phrase`}
+		}
+		return &queryNode{Field: field.Field, Keyword: field.Keyword, Text: value.Text, Phrase: value.Kind == tokenPhrase}, nil
+	case tokenOpen:
+		parser.depth++
+		if parser.depth > maxQueryDepth {
+			return nil, &QuerySyntaxError{token.Position, fmt.Sprintf(`more than %d nested groups`, maxQueryDepth)}
+		}
+		node, err := parser.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if closing := parser.advance(); closing.Kind != tokenClose {
+			return nil, &QuerySyntaxError{token.Position, `unclosed parenthesis`}
+		}
+		parser.depth--
+		return node, nil
+	}
+	return nil, &QuerySyntaxError{token.Position, `expected a search term, got ` + describeToken(token)}
+}
+
+// clause returns the OpenSearch query for node. Text without a field is
+// searched over searchFields.
+func (node *queryNode) clause(searchFields []string) interface{} {
+	if node.Clauses != nil {
+		query := boolQuery{}
+		for _, clause := range node.Clauses {
+			switch clause.Occur {
+			case occurMust:
+				query.Bool.Must = append(query.Bool.Must, clause.Node.clause(searchFields))
+			case occurMustNot:
+				query.Bool.MustNot = append(query.Bool.MustNot, clause.Node.clause(searchFields))
+			default:
+				query.Bool.Should = append(query.Bool.Should, clause.Node.clause(searchFields))
+			}
+		}
+		return query
+	}
+	switch {
+	case node.Field == `` && node.Phrase:
+		multiMatch := newMultiMatchQuery(node.Text, searchFields...)
+		multiMatch.MultiMatch.Type = "phrase"
+		return multiMatch
+	case node.Field == ``:
+		multiMatch := newMultiMatchQuery(node.Text, searchFields...)
+		multiMatch.MultiMatch.Fuzziness = "AUTO"
+		return multiMatch
+	case node.Keyword:
+		return newTermQuery(node.Field, node.Text)
+	case node.Phrase:
+		return map[string]interface{}{"match_phrase": map[string]string{node.Field: node.Text}}
+	}
+	return map[string]interface{}{
+		"match": map[string]interface{}{
+			node.Field: map[string]string{"query": node.Text, "fuzziness": "AUTO"},
+		},
+	}
+}
@@ -0,0 +1,123 @@
+package search
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestParseQueryString(t *testing.T) {
+	tests := []struct {
+		query    string
+		expected string
+	}{
+		{
+			`open access`,
+			`{"multi_match":{"query":"open access","fields":["title^3"],"fuzziness":"AUTO"}}`,
+		},
+		{
+			`"open access"`,
+			`{"multi_match":{"query":"open access","type":"phrase","fields":["title^3"]}}`,
+		},
+		{
+			`open -draft`,
+			`{"bool":{"should":[{"multi_match":{"query":"open","fields":["title^3"],"fuzziness":"AUTO"}}],"must_not":[{"multi_match":{"query":"draft","fields":["title^3"],"fuzziness":"AUTO"}}]}}`,
+		},
+		{
+			`+open access`,
+			`{"bool":{"must":[{"multi_match":{"query":"open","fields":["title^3"],"fuzziness":"AUTO"}}],"should":[{"multi_match":{"query":"access","fields":["title^3"],"fuzziness":"AUTO"}}]}}`,
+		},
+		{
+			`title:commons content_type:post`,
+			`{"bool":{"should":[{"match":{"title":{"fuzziness":"AUTO","query":"commons"}}},{"term":{"content_type":{"value":"post"}}}]}}`,
+		},
+		{
+			`author:"Jane Doe" AND NOT language:fr`,
+			`{"bool":{"must":[{"match_phrase":{"contributors.name":"Jane Doe"}},{"bool":{"must_not":[{"term":{"language":{"value":"fr"}}}]}}]}}`,
+		},
+		{
+			`(open OR free) AND access`,
+			`{"bool":{"must":[{"bool":{"should":[{"multi_match":{"query":"open","fields":["title^3"],"fuzziness":"AUTO"}},{"multi_match":{"query":"free","fields":["title^3"],"fuzziness":"AUTO"}}]}},{"multi_match":{"query":"access","fields":["title^3"],"fuzziness":"AUTO"}}]}}`,
+		},
+		{
+			`a OR b AND c`,
+			`{"bool":{"should":[{"multi_match":{"query":"a","fields":["title^3"],"fuzziness":"AUTO"}},{"bool":{"must":[{"multi_match":{"query":"b","fields":["title^3"],"fuzziness":"AUTO"}},{"multi_match":{"query":"c","fields":["title^3"],"fuzziness":"AUTO"}}]}}]}}`,
+		},
+		{
+			`co-op and or not title:OR`,
+			`{"bool":{"should":[{"multi_match":{"query":"co-op and or not","fields":["title^3"],"fuzziness":"AUTO"}},{"match":{"title":{"fuzziness":"AUTO","query":"OR"}}}]}}`,
+		},
+		{
+			`Commons: a history`,
+			`{"multi_match":{"query":"Commons: a history","fields":["title^3"],"fuzziness":"AUTO"}}`,
+		},
+		{
+			`https://doi.org/10.17613/abc-123`,
+			`{"multi_match":{"query":"https://doi.org/10.17613/abc-123","fields":["title^3"],"fuzziness":"AUTO"}}`,
+		},
+		{
+			`titel:open title: open`,
+			`{"multi_match":{"query":"titel:open title: open","fields":["title^3"],"fuzziness":"AUTO"}}`,
+		},
+	}
+	for _, tt := range tests {
+		node, err := parseQueryString(tt.query)
+		if err != nil {
+			t.Errorf("%s: error parsing query: %v", tt.query, err)
+			continue
+		}
+		clause, _ := json.Marshal(node.clause([]string{"title^3"}))
+		if string(clause) != tt.expected {
+			t.Errorf("%s: expected\n%s\ngot\n%s", tt.query, tt.expected, clause)
+		}
+	}
+}
+
+func TestParseQueryStringErrors(t *testing.T) {
+	tests := []struct {
+		query    string
+		position int
+	}{
+		{`open "access`, 5},
+		{`(open access`, 0},
+		{`open access)`, 11},
+		{`AND open`, 0},
+		{`open OR`, 7},
+		{`open AND NOT`, 12},
+		{`""`, 0},
+		{`()`, 1},
+		{strings.Repeat(`(`, maxQueryDepth+1) + `open` + strings.Repeat(`)`, maxQueryDepth+1), maxQueryDepth},
+		{strings.Repeat(`a OR `, maxQueryClauses) + `a`, 5 * maxQueryClauses},
+	}
+	for _, tt := range tests {
+		_, err := parseQueryString(tt.query)
+		var syntaxError *QuerySyntaxError
+		if !errors.As(err, &syntaxError) {
+			t.Errorf("%s: expected QuerySyntaxError, got %v", tt.query, err)
+			continue
+		}
+		if syntaxError.Position != tt.position {
+			t.Errorf("%s: expected error at %d, got %v", tt.query, tt.position, syntaxError)
+		}
+	}
+}
+
+func FuzzParseQueryString(f *testing.F) {
+	for _, seed := range append(queryFuzzSeeds, `(a OR "b c") AND -title:d`, `+-a`, `a:"b`) {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, input string) {
+		node, err := parseQueryString(input)
+		if err != nil {
+			var syntaxError *QuerySyntaxError
+			if !errors.As(err, &syntaxError) || syntaxError.Position < 0 || syntaxError.Position > len(input) {
+				t.Fatalf("Expected QuerySyntaxError within the query, got %v", err)
+			}
+			return
+		}
+		if _, err := json.Marshal(node.clause(DefaultSearchFields)); err != nil {
+			t.Fatalf("Error marshalling clause: %v", err)
+		}
+	})
+}
@@ -0,0 +1,109 @@
+package search
+
+import (
+	"encoding/json"
+	"io"
+	"slices"
+	"testing"
+	"unicode/utf8"
+)
+
+var queryFuzzSeeds = []string{
+	"searching",
+	"",
+	`"`,
+	`\`,
+	`open "access"`,
+	`"}},"size":10000,"x":{"`,
+	`"}}]}},"script":{"source":"ctx._source.clear()"},"q":{"`,
+	"\x00\n\t ",
+	"\xff\xfe",
+}
+
+// Decodes a query body and checks that its structure is exactly as expected,
+// returning the clause at query.bool.must[0].
+func decodeQuery(t *testing.T, body io.Reader, expectedKeys []string) map[string]interface{} {
+	var decoded map[string]interface{}
+	err := json.NewDecoder(body).Decode(&decoded)
+	if err != nil {
+		t.Fatalf("Query is not valid JSON: %v", err)
+	}
+	keys := []string{}
+	for key := range decoded {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	if !slices.Equal(keys, expectedKeys) {
+		t.Fatalf("Expected top-level keys %v, got %v", expectedKeys, keys)
+	}
+	query := decoded["query"].(map[string]interface{})
+	if len(query) != 1 {
+		t.Fatalf("Expected only bool query, got %v", query)
+	}
+	boolQuery := query["bool"].(map[string]interface{})
+	if len(boolQuery) != 1 {
+		t.Fatalf("Expected only must clauses, got %v", boolQuery)
+	}
+	must := boolQuery["must"].([]interface{})
+	if len(must) != 1 {
+		t.Fatalf("Expected a single must clause, got %v", must)
+	}
+	return must[0].(map[string]interface{})
+}
+
+// Checks that input survived marshalling unchanged. Invalid UTF-8 is replaced
+// by encoding/json, so only valid strings are compared.
+func checkValue(t *testing.T, input string, value interface{}) {
+	if utf8.ValidString(input) && value != input {
+		t.Fatalf("Expected value %q, got %q", input, value)
+	}
+}
+
+func FuzzBasicSearchQuery(f *testing.F) {
+	for _, seed := range queryFuzzSeeds {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, input string) {
+		clause := decodeQuery(t, basicSearchQuery(input).reader(), []string{"query"})
+		multiMatch := clause["multi_match"].(map[string]interface{})
+		if len(clause) != 1 || len(multiMatch) != 1 {
+			t.Fatalf("Expected only multi_match query, got %v", clause)
+		}
+		checkValue(t, input, multiMatch["query"])
+	})
+}
+
+func FuzzTypeAheadQuery(f *testing.F) {
+	for _, seed := range queryFuzzSeeds {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, input string) {
+		clause := decodeQuery(t, typeAheadQuery(input, nil).reader(), []string{"fields", "query", "size"})
+		multiMatch := clause["multi_match"].(map[string]interface{})
+		if len(clause) != 1 || len(multiMatch) != 3 {
+			t.Fatalf("Expected only multi_match query, got %v", clause)
+		}
+		if multiMatch["type"] != "bool_prefix" {
+			t.Fatalf("Expected bool_prefix query, got %v", multiMatch["type"])
+		}
+		checkValue(t, input, multiMatch["query"])
+	})
+}
+
+func FuzzDeleteNodeQuery(f *testing.F) {
+	for _, seed := range queryFuzzSeeds {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, input string) {
+		clause := decodeQuery(t, deleteNodeQuery(input).reader(), []string{"query"})
+		term := clause["term"].(map[string]interface{})
+		if len(clause) != 1 || len(term) != 1 {
+			t.Fatalf("Expected only a term query, got %v", clause)
+		}
+		value := term["network_node"].(map[string]interface{})
+		if len(value) != 1 {
+			t.Fatalf("Expected only a term value, got %v", value)
+		}
+		checkValue(t, input, value["value"])
+	})
+}
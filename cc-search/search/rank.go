@@ -0,0 +1,159 @@
+package search
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/MESH-Research/commons-connect/cc-search/types"
+)
+
+// Rankings that can be requested with the `rank` search parameter.
+const (
+	RankRelevance = "relevance"
+	RankRecent    = "recent"
+)
+
+// Recency boost used when the configuration does not set one. A document
+// published now scores twice as high as an undated one with the same terms,
+// and one published a year ago one and a half times as high.
+const (
+	DefaultRecencyScale  = "365d"
+	DefaultRecencyWeight = 1.0
+)
+
+// The recency boost of a document published the scale ago is this fraction
+// of the boost of one published now.
+const recencyDecay = 0.5
+
+// The field that recency is measured by.
+const recencyField = "publication_date"
+
+var recencyScalePattern = regexp.MustCompile(`^([0-9]{1,6})(ms|s|m|h|d)$`)
+
+type functionScoreQuery struct {
+	FunctionScore struct {
+		Query     interface{}   `json:"query"`
+		Functions []interface{} `json:"functions"`
+		ScoreMode string        `json:"score_mode"`
+		BoostMode string        `json:"boost_mode"`
+	} `json:"function_score"`
+}
+
+type gaussFunction struct {
+	Filter interface{}           `json:"filter,omitempty"`
+	Gauss  map[string]gaussDecay `json:"gauss"`
+	Weight float64               `json:"weight"`
+}
+
+type gaussDecay struct {
+	Origin string  `json:"origin"`
+	Scale  string  `json:"scale"`
+	Decay  float64 `json:"decay"`
+}
+
+// RecencyBoost returns the recency boost for a search with rank, or the
+// ranking set in conf if rank is empty. It returns nil when results are
+// ranked by relevance alone.
+func RecencyBoost(conf types.Config, rank string) (*types.RecencyBoost, error) {
+	if rank == `` {
+		rank = conf.Rank
+	}
+	switch rank {
+	case ``, RankRelevance:
+		return nil, nil
+	case RankRecent:
+	default:
+		return nil, fmt.Errorf(`invalid rank: %s (valid ranks: %s, %s)`, rank, RankRelevance, RankRecent)
+	}
+	boost := &types.RecencyBoost{Scale: conf.RecencyScale, Weight: conf.RecencyWeight}
+	if boost.Scale == `` {
+		boost.Scale = DefaultRecencyScale
+	}
+	if boost.Weight == 0 {
+		boost.Weight = DefaultRecencyWeight
+	}
+	if _, err := parseRecencyScale(boost.Scale); err != nil {
+		return nil, err
+	}
+	if boost.Weight < 0 {
+		return nil, fmt.Errorf(`invalid recency weight: %g`, boost.Weight)
+	}
+	return boost, nil
+}
+
+// ValidateRanking returns an error if conf sets an invalid ranking, or a
+// recency scale or weight that searches ranked by recency could not use.
+func ValidateRanking(conf types.Config) error {
+	if _, err := RecencyBoost(conf, ``); err != nil {
+		return err
+	}
+	_, err := RecencyBoost(conf, RankRecent)
+	return err
+}
+
+// parseRecencyScale parses a scale in OpenSearch time units, eg. 365d or 12h.
+func parseRecencyScale(scale string) (time.Duration, error) {
+	match := recencyScalePattern.FindStringSubmatch(scale)
+	if match == nil || strings.Trim(match[1], "0") == `` {
+		return 0, fmt.Errorf(`invalid recency scale: %s (use a number of days, hours, minutes, seconds or milliseconds, eg. 365d)`, scale)
+	}
+	n, _ := strconv.Atoi(match[1])
+	unit := map[string]time.Duration{
+		"ms": time.Millisecond,
+		"s":  time.Second,
+		"m":  time.Minute,
+		"h":  time.Hour,
+		"d":  24 * time.Hour,
+	}[match[2]]
+	return time.Duration(n) * unit, nil
+}
+
+// recencyQuery wraps the scored clauses of a search in a function score that
+// multiplies their score by one plus the decayed recency boost. Undated
+// documents are not boosted.
+func recencyQuery(must []interface{}, boost *types.RecencyBoost) functionScoreQuery {
+	query := functionScoreQuery{}
+	switch len(must) {
+	case 0:
+		query.FunctionScore.Query = map[string]interface{}{"match_all": map[string]interface{}{}}
+	case 1:
+		query.FunctionScore.Query = must[0]
+	default:
+		scored := boolQuery{}
+		scored.Bool.Must = must
+		query.FunctionScore.Query = scored
+	}
+	query.FunctionScore.Functions = []interface{}{
+		map[string]float64{"weight": 1},
+		gaussFunction{
+			Filter: newExistsQuery(recencyField),
+			Gauss: map[string]gaussDecay{
+				recencyField: {Origin: "now", Scale: boost.Scale, Decay: recencyDecay},
+			},
+			Weight: boost.Weight,
+		},
+	}
+	query.FunctionScore.ScoreMode = "sum"
+	query.FunctionScore.BoostMode = "multiply"
+	return query
+}
+
+// recencyFactor returns the factor that recencyQuery multiplies the score of
+// document by at now.
+func recencyFactor(document types.Document, boost *types.RecencyBoost, now time.Time) float64 {
+	published, err := parseDateBound(document.PublicationDate, now, false)
+	if document.PublicationDate == `` || err != nil {
+		return 1
+	}
+	scale, err := parseRecencyScale(boost.Scale)
+	if err != nil {
+		return 1
+	}
+	distance := now.Sub(published).Seconds()
+	variance := -math.Pow(scale.Seconds(), 2) / (2 * math.Log(recencyDecay))
+	return 1 + boost.Weight*math.Exp(-distance*distance/(2*variance))
+}
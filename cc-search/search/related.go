@@ -0,0 +1,85 @@
+package search
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+
+	opensearchapi "github.com/opensearch-project/opensearch-go/v2/opensearchapi"
+
+	"github.com/MESH-Research/commons-connect/cc-search/types"
+)
+
+// Fields compared to find related documents.
+var relatedFields = []string{"title", "description", "content"}
+
+// Fields that related documents may be restricted by.
+var RelatedFilterFields = []string{"content_type", "network_node"}
+
+type moreLikeThisQuery struct {
+	MoreLikeThis struct {
+		Fields []string          `json:"fields"`
+		Like   []moreLikeThisDoc `json:"like"`
+		// Terms must appear at least this often in the source document and
+		// in the index to be used. The OpenSearch defaults of 2 and 5 find
+		// nothing for short posts.
+		MinTermFreq int `json:"min_term_freq"`
+		MinDocFreq  int `json:"min_doc_freq"`
+		// The source document is excluded from its own results.
+		Include bool `json:"include"`
+	} `json:"more_like_this"`
+}
+
+type moreLikeThisDoc struct {
+	Index string `json:"_index"`
+	ID    string `json:"_id"`
+}
+
+// relatedQuery matches documents similar to the document with id, restricted
+// by params.ExactMatch, params.ExcludeMatch and params.Viewer.
+func relatedQuery(index string, id string, params types.SearchParams) queryData {
+	queryData := queryData{
+		Size:   pageSize(params),
+		Fields: params.ReturnFields,
+	}
+	moreLikeThis := moreLikeThisQuery{}
+	moreLikeThis.MoreLikeThis.Fields = relatedFields
+	moreLikeThis.MoreLikeThis.Like = []moreLikeThisDoc{{Index: index, ID: id}}
+	moreLikeThis.MoreLikeThis.MinTermFreq = 1
+	moreLikeThis.MoreLikeThis.MinDocFreq = 1
+	queryData.Query.Bool.Must = append(queryData.Query.Bool.Must, moreLikeThis)
+	queryData.addExactMatches(params)
+	if params.Viewer != nil {
+		queryData.Query.Bool.Filter = append(queryData.Query.Bool.Filter, visibilityQuery(params.Viewer))
+	}
+	return queryData
+}
+
+// RelatedDocuments returns the documents most similar to the document with id
+// by title, description and content. params.PerPage, params.ReturnFields,
+// params.ExactMatch, params.ExcludeMatch and params.Viewer apply as for Search.
+func RelatedDocuments(ctx context.Context, searcher types.Searcher, id string, params types.SearchParams) (types.SearchResponse, error) {
+	req := opensearchapi.SearchRequest{
+		Index: []string{searcher.IndexName},
+		Body:  relatedQuery(searcher.IndexName, id, params).reader(),
+	}
+	response, err := req.Do(ctx, searcher.Client)
+	if err != nil {
+		return types.SearchResponse{}, err
+	}
+	defer response.Body.Close()
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		return types.SearchResponse{}, err
+	}
+	if response.StatusCode != 200 {
+		return types.SearchResponse{}, errors.New(string(body))
+	}
+	var searchResult types.SearchResult
+	err = json.Unmarshal(body, &searchResult)
+	if err != nil {
+		return types.SearchResponse{}, err
+	}
+	return searchResultToResponse(&searchResult, params), nil
+}
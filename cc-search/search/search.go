@@ -2,10 +2,14 @@
 package search
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log"
+	"regexp"
 	"strings"
 
 	opensearchapi "github.com/opensearch-project/opensearch-go/v2/opensearchapi"
@@ -13,12 +17,55 @@ import (
 	"github.com/MESH-Research/commons-connect/cc-search/types"
 )
 
-func RawSearch(searcher types.Searcher, query string) (string, error) {
+// DefaultSearchFields are the fields searched by the multi_match query when
+// neither the request nor the service configuration specify any. Boosts use
+// the OpenSearch `field^boost` syntax so that title matches are not buried
+// under long content bodies.
+var DefaultSearchFields = []string{
+	"title^3",
+	"description^2",
+	"content",
+	"owner.name",
+	"contributors.name",
+}
+
+var searchFieldPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.]*(\^[0-9]+(\.[0-9]+)?)?$`)
+
+// ParseSearchFields parses a comma-separated list of search fields with
+// optional boosts, eg. `title^3,description^2,content`.
+func ParseSearchFields(fieldList string) ([]string, error) {
+	fields := []string{}
+	for _, field := range strings.Split(fieldList, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		if !searchFieldPattern.MatchString(field) {
+			return nil, fmt.Errorf(`invalid search field: %s`, field)
+		}
+		fields = append(fields, field)
+	}
+	if len(fields) == 0 {
+		return nil, errors.New(`no search fields provided`)
+	}
+	return fields, nil
+}
+
+// ConfiguredSearchFields returns the search fields set in the service
+// configuration, falling back to DefaultSearchFields.
+func ConfiguredSearchFields(conf types.Config) ([]string, error) {
+	if conf.SearchFields == "" {
+		return DefaultSearchFields, nil
+	}
+	return ParseSearchFields(conf.SearchFields)
+}
+
+func RawSearch(ctx context.Context, searcher types.Searcher, query string) (string, error) {
 	req := opensearchapi.SearchRequest{
 		Index: []string{searcher.IndexName},
 		Body:  strings.NewReader(query),
 	}
-	response, err := req.Do(context.Background(), searcher.Client)
+	response, err := req.Do(ctx, searcher.Client)
 	if err != nil {
 		return ``, err
 	}
@@ -30,20 +77,12 @@ func RawSearch(searcher types.Searcher, query string) (string, error) {
 	return string(body), nil
 }
 
-func BasicSearch(searcher types.Searcher, query string) (*types.SearchResult, error) {
-	QueryJSON := fmt.Sprintf(`{
-		"query": {
-			"multi_match": {
-				"query": "%s"
-			}
-		}
-	}`, query)
-
+func BasicSearch(ctx context.Context, searcher types.Searcher, query string) (*types.SearchResult, error) {
 	req := opensearchapi.SearchRequest{
 		Index: []string{searcher.IndexName},
-		Body:  strings.NewReader(QueryJSON),
+		Body:  basicSearchQuery(query).reader(),
 	}
-	response, err := req.Do(context.Background(), searcher.Client)
+	response, err := req.Do(ctx, searcher.Client)
 	if err != nil {
 		return nil, err
 	}
@@ -60,13 +99,25 @@ func BasicSearch(searcher types.Searcher, query string) (*types.SearchResult, er
 	return &searchResult, nil
 }
 
-func Search(searcher types.Searcher, params types.SearchParams) (types.SearchResponse, error) {
+func Search(ctx context.Context, searcher types.Searcher, params types.SearchParams) (types.SearchResponse, error) {
+	if _, err := parseQueryString(params.Query); err != nil {
+		return types.SearchResponse{}, err
+	}
+	if params.Cursor != "" {
+		err := applyCursor(ctx, searcher, &params)
+		if err != nil {
+			return types.SearchResponse{}, err
+		}
+	}
 	query := buildQuery(params)
 	req := opensearchapi.SearchRequest{
-		Index: []string{searcher.IndexName},
-		Body:  strings.NewReader(query),
+		Body: strings.NewReader(query),
 	}
-	response, err := req.Do(context.Background(), searcher.Client)
+	// Searches against a point in time must not specify an index.
+	if params.PointInTimeID == "" {
+		req.Index = []string{searcher.IndexName}
+	}
+	response, err := req.Do(ctx, searcher.Client)
 	if err != nil {
 		return types.SearchResponse{}, err
 	}
@@ -75,32 +126,67 @@ func Search(searcher types.Searcher, params types.SearchParams) (types.SearchRes
 	if err != nil {
 		return types.SearchResponse{}, err
 	}
+	if response.StatusCode != 200 {
+		return types.SearchResponse{}, errors.New(string(body))
+	}
 	var searchResult types.SearchResult
 	err = json.Unmarshal(body, &searchResult)
 	if err != nil {
 		return types.SearchResponse{}, err
 	}
 
-	return searchResultToResponse(&searchResult, params), nil
-}
-
-func TypeAheadSearch(searcher types.Searcher, query string) ([]types.Document, error) {
-	queryJson := fmt.Sprintf(`{
-		"fields": ["title", "primary_url", "other_urls"],
-		"size": 5,
-		"query": {
-			"multi_match": {
-				"query": "%s",
-				"type": "bool_prefix",
-				"fields": ["title"]
+	searchResponse := searchResultToResponse(&searchResult, params)
+	if suggestionsWanted(params, searchResponse.Total) {
+		if !suggestionsEnabled(params) {
+			err = searchSuggestions(ctx, searcher, params, &searchResult)
+			if err != nil {
+				log.Println(`Error getting suggestions: `, err)
 			}
 		}
-	}`, query)
+		searchResponse.Suggestions = searchResultToSuggestions(&searchResult)
+	}
+	if params.Cursor != "" {
+		searchResponse.Cursor = nextCursor(ctx, searcher, &searchResult, params, pageSize(params))
+	}
+	return searchResponse, nil
+}
+
+// searchSuggestions fetches the suggestions for params into searchResult, for
+// searches that found fewer hits than the suggest threshold without having
+// asked for suggestions along with their hits.
+func searchSuggestions(ctx context.Context, searcher types.Searcher, params types.SearchParams, searchResult *types.SearchResult) error {
+	body, err := json.Marshal(suggestQuery{Suggest: suggestSection(params)})
+	if err != nil {
+		return err
+	}
 	req := opensearchapi.SearchRequest{
 		Index: []string{searcher.IndexName},
-		Body:  strings.NewReader(queryJson),
+		Body:  bytes.NewReader(body),
+	}
+	response, err := req.Do(ctx, searcher.Client)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != 200 {
+		bodyBytes, _ := io.ReadAll(response.Body)
+		return errors.New(string(bodyBytes))
 	}
-	response, err := req.Do(context.Background(), searcher.Client)
+	var suggestResult types.SearchResult
+	err = json.NewDecoder(response.Body).Decode(&suggestResult)
+	if err != nil {
+		return err
+	}
+	searchResult.Suggest = suggestResult.Suggest
+	return nil
+}
+
+func TypeAheadSearch(ctx context.Context, searcher types.Searcher, query string, viewer *types.Viewer) ([]types.Document, error) {
+	req := opensearchapi.SearchRequest{
+		Index: []string{searcher.IndexName},
+		Body:  typeAheadQuery(query, viewer).reader(),
+	}
+	response, err := req.Do(ctx, searcher.Client)
 	if err != nil {
 		return nil, err
 	}
@@ -116,104 +202,77 @@ func TypeAheadSearch(searcher types.Searcher, query string) ([]types.Document, e
 	}
 	docs := searchResultToDocuments(&searchResult)
 	for i := range docs {
-		docs[i].FilterByJSON([]string{"title", "primary_url", "other_urls"})
+		docs[i].FilterByJSON(typeAheadFields)
 	}
 	return docs, nil
 }
 
-type queryData struct {
-	From   int               `json:"from,omitempty"`
-	Size   int               `json:"size,omitempty"`
-	Fields []string          `json:"fields,omitempty"`
-	Sort   map[string]string `json:"sort,omitempty"`
-	Query  struct {
-		Bool struct {
-			Must       []interface{} `json:"must,omitempty"`
-			DateFilter []interface{} `json:"filter,omitempty"`
-		} `json:"bool,omitempty"`
-	} `json:"query"`
-}
-
-type multiMatchQuery struct {
-	MultiMatch struct {
-		Query     string   `json:"query,omitempty"`
-		Fields    []string `json:"fields,omitempty"`
-		Fuzziness string   `json:"fuzziness,omitempty"`
-	} `json:"multi_match,omitempty"`
-}
-
-type dateQuery struct {
-	Range struct {
-		PublicationDate struct {
-			GTE string `json:"gte,omitempty"`
-			LTE string `json:"lte,omitempty"`
-		} `json:"publication_date,omitempty"`
-	} `json:"range"`
+func pageSize(params types.SearchParams) int {
+	if params.PerPage > 0 {
+		return params.PerPage
+	}
+	return 20
 }
 
 func buildQuery(params types.SearchParams) string {
 	queryData := queryData{}
-	if params.PerPage > 0 {
-		queryData.Size = params.PerPage
-	} else {
-		queryData.Size = 20
-	}
-	if params.Page > 0 {
+	queryData.Size = pageSize(params)
+	if params.Page > 0 && params.Cursor == "" {
 		queryData.From = (params.Page - 1) * queryData.Size
 	}
 	queryData.Fields = params.ReturnFields
 	if params.Query != "" {
-		baseQuery := multiMatchQuery{}
-		baseQuery.MultiMatch.Query = params.Query
-		baseQuery.MultiMatch.Fuzziness = "AUTO"
+		searchFields := params.SearchFields
+		if len(searchFields) == 0 {
+			searchFields = DefaultSearchFields
+		}
+		// Search rejects queries that do not parse before building them, so
+		// this only falls back to searching the raw text when called directly.
+		node, err := parseQueryString(params.Query)
+		if err != nil {
+			node = textNode(params.Query)
+		}
 		queryData.Query.Bool.Must = append(
 			queryData.Query.Bool.Must,
-			baseQuery,
+			node.clause(searchFields),
 		)
 	}
-	if len(params.ExactMatch) > 0 {
-		for field, value := range params.ExactMatch {
-			queryData.Query.Bool.Must = append(
-				queryData.Query.Bool.Must,
-				struct {
-					Term map[string]struct {
-						Value string `json:"value,omitempty"`
-					} `json:"term,omitempty"`
-				}{
-					Term: map[string]struct {
-						Value string `json:"value,omitempty"`
-					}{
-						field: {
-							Value: value,
-						},
-					},
-				})
-		}
+	if params.Recency != nil {
+		queryData.Query.Bool.Must = []interface{}{recencyQuery(queryData.Query.Bool.Must, params.Recency)}
 	}
+	queryData.addExactMatches(params)
 	if params.StartDate != "" || params.EndDate != "" {
-		dateQuery := dateQuery{}
-		if params.StartDate != "" {
-			dateQuery.Range.PublicationDate.GTE = params.StartDate
+		dateQuery := dateQuery{
+			Range: map[string]dateRange{
+				dateField(params): {GTE: params.StartDate, LTE: params.EndDate},
+			},
 		}
-		if params.EndDate != "" {
-			dateQuery.Range.PublicationDate.LTE = params.EndDate
-		}
-		queryData.Query.Bool.DateFilter = append(
-			queryData.Query.Bool.DateFilter,
+		queryData.Query.Bool.Filter = append(
+			queryData.Query.Bool.Filter,
 			dateQuery,
 		)
 	}
-	if params.SortField != "" {
-		queryData.Sort = make(map[string]string)
-		switch params.SortDirection {
-		case "asc":
-			queryData.Sort[params.SortField] = "asc"
-		case "desc":
-			queryData.Sort[params.SortField] = "desc"
-		default:
-			queryData.Sort[params.SortField] = "asc"
+	if params.Viewer != nil {
+		queryData.Query.Bool.Filter = append(
+			queryData.Query.Bool.Filter,
+			visibilityQuery(params.Viewer),
+		)
+	}
+	queryData.Sort = sortClauses(params.Sort, params.Cursor != "", params.PointInTimeID != "")
+	if params.Cursor != "" {
+		queryData.SearchAfter = params.SearchAfter
+		if params.PointInTimeID != "" {
+			queryData.PIT = &pointInTime{
+				ID:        params.PointInTimeID,
+				KeepAlive: fmt.Sprintf("%dm", int(pointInTimeKeepAlive.Minutes())),
+			}
 		}
 	}
+	queryData.Aggs = buildAggregations(params.Facets)
+	if params.Highlight {
+		queryData.Highlight = buildHighlight(params.HighlightFields, params.FragmentSize)
+	}
+	queryData.Suggest = buildSuggest(params)
 	queryJSON, _ := json.Marshal(queryData)
 	return string(queryJSON)
 }
@@ -227,15 +286,18 @@ func searchResultToDocuments(searchResult *types.SearchResult) []types.Document
 }
 
 func searchResultToResponse(searchResult *types.SearchResult, searchParams types.SearchParams) types.SearchResponse {
-	documents := make([]types.Document, 0)
+	hits := make([]types.SearchHit, 0)
 
 	for _, hit := range searchResult.Hits.Hits {
 		if len(searchParams.ReturnFields) > 0 {
 			hit.Source.FilterByJSON(searchParams.ReturnFields)
 		}
-		newDocument := hit.Source
-		newDocument.ID = hit.ID
-		documents = append(documents, newDocument)
+		newHit := types.SearchHit{
+			Document:   hit.Source,
+			Highlights: hit.Highlight,
+		}
+		newHit.ID = hit.ID
+		hits = append(hits, newHit)
 	}
 
 	return types.SearchResponse{
@@ -243,6 +305,7 @@ func searchResultToResponse(searchResult *types.SearchResult, searchParams types
 		Page:      searchParams.Page,
 		PerPage:   searchParams.PerPage,
 		RequestID: searchParams.RequestID,
-		Hits:      documents,
+		Hits:      hits,
+		Facets:    searchResultToFacets(searchResult),
 	}
 }
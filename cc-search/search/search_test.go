@@ -4,9 +4,20 @@ package search
 // run `lando start` before running these tests.
 
 import (
+	"context"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"log"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/MESH-Research/commons-connect/cc-search/config"
 	"github.com/MESH-Research/commons-connect/cc-search/types"
@@ -20,7 +31,7 @@ var testDocumentJSON = `{
 }`
 
 func cleanSetup() types.Searcher {
-	client, err := GetClientNoAuth("http://localhost:9200")
+	client, err := GetClientNoAuth("http://localhost:9200", nil)
 	if err != nil {
 		log.Fatalf("Error getting client: %v", err)
 	}
@@ -28,12 +39,12 @@ func cleanSetup() types.Searcher {
 		Client:    client,
 		IndexName: "test",
 	}
-	_ = DeleteIndex(&searcher)
+	_ = DeleteIndex(context.Background(), &searcher)
 	return searcher
 }
 
 func resetIndex(searcher *types.Searcher) {
-	err := CreateIndex(searcher)
+	err := CreateIndex(context.Background(), searcher)
 	if err != nil {
 		log.Fatalf("Error creating index: %v", err)
 	}
@@ -42,12 +53,12 @@ func resetIndex(searcher *types.Searcher) {
 func TestDeleteIndex(t *testing.T) {
 	searcher := cleanSetup()
 	resetIndex(&searcher)
-	err := DeleteIndex(&searcher)
+	err := DeleteIndex(context.Background(), &searcher)
 	if err != nil {
 		t.Errorf("Expected no error when deleting existing index, got %v", err)
 	}
 	searcher.IndexName = "nonexistent"
-	err = DeleteIndex(&searcher)
+	err = DeleteIndex(context.Background(), &searcher)
 	if err == nil {
 		t.Errorf("Expected error when deleting non-existing index, got nil")
 	}
@@ -55,7 +66,7 @@ func TestDeleteIndex(t *testing.T) {
 
 func TestCreateIndex(t *testing.T) {
 	searcher := cleanSetup()
-	err := CreateIndex(&searcher)
+	err := CreateIndex(context.Background(), &searcher)
 	if err != nil {
 		t.Errorf("Error creating index: %v", err)
 	}
@@ -72,7 +83,7 @@ func TestIndexDocument(t *testing.T) {
 	if err != nil {
 		t.Errorf("Error unmarshalling JSON: %v", err)
 	}
-	doc, err := IndexDocument(searcher, testDocument)
+	doc, err := IndexDocument(context.Background(), searcher, testDocument)
 	if err != nil {
 		t.Errorf("Error indexing document: %v", err)
 	}
@@ -92,6 +103,7 @@ func TestGetAWSClient(t *testing.T) {
 		conf.SearchEndpoint,
 		conf.User,
 		conf.Password,
+		nil,
 	)
 	if err != nil {
 		t.Errorf("Error getting client: %v", err)
@@ -109,11 +121,11 @@ func TestBasicSearch(t *testing.T) {
 	if err != nil {
 		t.Errorf("Error unmarshalling JSON: %v", err)
 	}
-	_, err = IndexDocument(searcher, testDocument)
+	_, err = IndexDocument(context.Background(), searcher, testDocument)
 	if err != nil {
 		t.Errorf("Error indexing document: %v", err)
 	}
-	result, err := BasicSearch(searcher, "searching")
+	result, err := BasicSearch(context.Background(), searcher, "searching")
 	if err != nil {
 		t.Errorf("Error searching: %v", err)
 	}
@@ -134,9 +146,9 @@ func TestBuildQuery(t *testing.T) {
 
 	query = buildQuery(
 		types.SearchParams{
-			ExactMatch: map[string]string{
-				"author": "Mike Thicke",
-				"year":   "2014",
+			ExactMatch: map[string][]string{
+				"author": {"Mike Thicke"},
+				"year":   {"2014"},
 			},
 		},
 	)
@@ -151,9 +163,8 @@ func TestBuildQuery(t *testing.T) {
 
 	query = buildQuery(
 		types.SearchParams{
-			Query:         "searching",
-			SortField:     "modified_date",
-			SortDirection: "desc",
+			Query: "searching",
+			Sort:  []types.SortKey{{Field: "modified_date", Direction: "desc"}},
 		},
 	)
 	if query == "" {
@@ -180,3 +191,876 @@ func TestBuildQuery(t *testing.T) {
 		t.Errorf("Error unmarshalling query: %v", err)
 	}
 }
+
+func TestBuildQueryExactMatch(t *testing.T) {
+	var unmarshalledQuery queryData
+	query := buildQuery(types.SearchParams{
+		Query:        "searching",
+		ExactMatch:   map[string][]string{"content_type": {"post", "group"}},
+		ExcludeMatch: map[string][]string{"network_node": {"mla"}},
+	})
+	err := json.Unmarshal([]byte(query), &unmarshalledQuery)
+	if err != nil {
+		t.Fatalf("Error unmarshalling query: %v", err)
+	}
+	if len(unmarshalledQuery.Query.Bool.Must) != 1 {
+		t.Errorf("Expected only the query to be scored, got %v", unmarshalledQuery.Query.Bool.Must)
+	}
+	filter, _ := json.Marshal(unmarshalledQuery.Query.Bool.Filter)
+	if string(filter) != `[{"terms":{"content_type":["post","group"]}}]` {
+		t.Errorf("Expected content type terms filter, got %s", filter)
+	}
+	mustNot, _ := json.Marshal(unmarshalledQuery.Query.Bool.MustNot)
+	if string(mustNot) != `[{"term":{"network_node":{"value":"mla"}}}]` {
+		t.Errorf("Expected network node exclusion, got %s", mustNot)
+	}
+}
+
+func TestBuildQueryVisibility(t *testing.T) {
+	var unmarshalledQuery queryData
+	query := buildQuery(types.SearchParams{Query: "searching"})
+	json.Unmarshal([]byte(query), &unmarshalledQuery)
+	if len(unmarshalledQuery.Query.Bool.Filter) != 0 {
+		t.Errorf("Expected no filter without a viewer, got %v", unmarshalledQuery.Query.Bool.Filter)
+	}
+
+	tests := []struct {
+		viewer  *types.Viewer
+		clauses int
+	}{
+		{&types.Viewer{}, 2},
+		{&types.Viewer{Username: "jdoe"}, 5},
+		{&types.Viewer{Username: "jdoe", Groups: []string{"editors"}}, 6},
+	}
+	for _, tt := range tests {
+		unmarshalledQuery = queryData{}
+		query = buildQuery(types.SearchParams{Query: "searching", Viewer: tt.viewer})
+		err := json.Unmarshal([]byte(query), &unmarshalledQuery)
+		if err != nil {
+			t.Fatalf("Error unmarshalling query: %v", err)
+		}
+		if len(unmarshalledQuery.Query.Bool.Filter) != 1 {
+			t.Fatalf("%+v: expected a visibility filter, got %v", tt.viewer, unmarshalledQuery.Query.Bool.Filter)
+		}
+		visibility := unmarshalledQuery.Query.Bool.Filter[0].(map[string]interface{})["bool"].(map[string]interface{})
+		if should := visibility["should"].([]interface{}); len(should) != tt.clauses {
+			t.Errorf("%+v: expected %d should clauses, got %v", tt.viewer, tt.clauses, should)
+		}
+		if visibility["minimum_should_match"] != 1.0 {
+			t.Errorf("%+v: expected minimum_should_match 1, got %v", tt.viewer, visibility["minimum_should_match"])
+		}
+	}
+}
+
+func TestRelatedQuery(t *testing.T) {
+	query := relatedQuery("test", "abc", types.SearchParams{
+		PerPage:      5,
+		ReturnFields: []string{"title"},
+		ExactMatch:   map[string][]string{"content_type": {"article"}},
+		Viewer:       &types.Viewer{},
+	})
+	var unmarshalledQuery queryData
+	err := json.NewDecoder(query.reader()).Decode(&unmarshalledQuery)
+	if err != nil {
+		t.Fatalf("Error unmarshalling query: %v", err)
+	}
+	if unmarshalledQuery.Size != 5 || len(unmarshalledQuery.Fields) != 1 {
+		t.Errorf("Expected size 5 and title field, got %d and %v", unmarshalledQuery.Size, unmarshalledQuery.Fields)
+	}
+	moreLikeThis := unmarshalledQuery.Query.Bool.Must[0].(map[string]interface{})["more_like_this"].(map[string]interface{})
+	like := moreLikeThis["like"].([]interface{})[0].(map[string]interface{})
+	if like["_index"] != "test" || like["_id"] != "abc" {
+		t.Errorf("Expected like document test/abc, got %v", like)
+	}
+	if moreLikeThis["include"] != false {
+		t.Errorf("Expected source document to be excluded, got include %v", moreLikeThis["include"])
+	}
+	if len(unmarshalledQuery.Query.Bool.Filter) != 2 {
+		t.Errorf("Expected content type and visibility filters, got %v", unmarshalledQuery.Query.Bool.Filter)
+	}
+}
+
+func TestBuildQuerySuggest(t *testing.T) {
+	var unmarshalledQuery queryData
+	json.Unmarshal([]byte(buildQuery(types.SearchParams{Query: "manuscrpts"})), &unmarshalledQuery)
+	if unmarshalledQuery.Suggest != nil {
+		t.Errorf("Expected no suggest section by default, got %v", unmarshalledQuery.Suggest)
+	}
+
+	// Suggestions below the threshold are fetched only once the hits are
+	// counted.
+	json.Unmarshal([]byte(buildQuery(types.SearchParams{Query: "manuscrpts", SuggestThreshold: 3})), &unmarshalledQuery)
+	if unmarshalledQuery.Suggest != nil {
+		t.Errorf("Expected no suggest section without suggest, got %v", unmarshalledQuery.Suggest)
+	}
+
+	query := buildQuery(types.SearchParams{Query: "manuscrpts", Suggest: true, Viewer: &types.Viewer{}})
+	unmarshalledQuery = queryData{}
+	err := json.Unmarshal([]byte(query), &unmarshalledQuery)
+	if err != nil {
+		t.Fatalf("Error unmarshalling query: %v", err)
+	}
+	if unmarshalledQuery.Suggest["text"] != "manuscrpts" {
+		t.Errorf("Expected suggest text manuscrpts, got %v", unmarshalledQuery.Suggest["text"])
+	}
+	for _, field := range suggestFields {
+		phrase := unmarshalledQuery.Suggest[field].(map[string]interface{})["phrase"].(map[string]interface{})
+		if phrase["field"] != field {
+			t.Errorf("Expected phrase suggester on %s, got %v", field, phrase["field"])
+		}
+		collate := phrase["collate"].(map[string]interface{})["query"].(map[string]interface{})["source"].(map[string]interface{})
+		if filter := collate["bool"].(map[string]interface{})["filter"]; len(filter.([]interface{})) != 1 {
+			t.Errorf("Expected collate query to filter by visibility, got %v", collate)
+		}
+	}
+}
+
+func TestSearchResultToSuggestions(t *testing.T) {
+	var searchResult types.SearchResult
+	err := json.Unmarshal([]byte(`{"suggest": {
+		"title": [{"text": "manuscrpts", "options": [{"text": "manuscripts", "score": 0.2}, {"text": "manuscript", "score": 0.1}]}],
+		"description": [{"text": "manuscrpts", "options": [{"text": "manuscripts", "score": 0.3}, {"text": "mandates", "score": 0.05}]}]
+	}}`), &searchResult)
+	if err != nil {
+		t.Fatalf("Error unmarshalling result: %v", err)
+	}
+	suggestions := searchResultToSuggestions(&searchResult)
+	expected := []string{"manuscripts", "manuscript", "mandates"}
+	if len(suggestions) != len(expected) {
+		t.Fatalf("Expected %v, got %v", expected, suggestions)
+	}
+	for i := range expected {
+		if suggestions[i] != expected[i] {
+			t.Errorf("Expected %v, got %v", expected, suggestions)
+			break
+		}
+	}
+}
+
+func TestSearchSuggestions(t *testing.T) {
+	bodies := []string{}
+	total := 1
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+		w.Header().Set("Content-Type", "application/json")
+		if strings.Contains(string(body), `"suggest"`) {
+			w.Write([]byte(`{"hits": {"total": {"value": 0}, "hits": []}, "suggest": {
+				"title": [{"text": "manuscrpts", "options": [{"text": "manuscripts", "score": 0.2}]}]
+			}}`))
+			return
+		}
+		w.Write([]byte(fmt.Sprintf(`{"hits": {"total": {"value": %d}, "hits": []}}`, total)))
+	}))
+	defer server.Close()
+	client, err := GetClientNoAuth(server.URL, nil)
+	if err != nil {
+		t.Fatalf("Error getting client: %v", err)
+	}
+	searcher := types.Searcher{IndexName: "test", Client: client}
+	params := types.SearchParams{Query: "manuscrpts", SuggestThreshold: 3}
+
+	// Too few hits: suggestions are fetched with a request of their own.
+	response, err := Search(context.Background(), searcher, params)
+	if err != nil {
+		t.Fatalf("Error searching: %v", err)
+	}
+	if len(bodies) != 2 || strings.Contains(bodies[0], `"suggest"`) || !strings.Contains(bodies[1], `"size":0`) {
+		t.Errorf("Expected a search without suggesters then a suggest request, got %v", bodies)
+	}
+	if !slices.Equal(response.Suggestions, []string{"manuscripts"}) {
+		t.Errorf("Expected suggestion manuscripts, got %v", response.Suggestions)
+	}
+
+	// Enough hits: no suggestions are asked for.
+	bodies, total = nil, 5
+	response, _ = Search(context.Background(), searcher, params)
+	if len(bodies) != 1 || response.Suggestions != nil {
+		t.Errorf("Expected a single search without suggestions, got %v, %v", bodies, response.Suggestions)
+	}
+}
+
+func TestCorrectTerms(t *testing.T) {
+	vocabulary := map[string]int{"medieval": 2, "manuscripts": 3, "manuscript": 1, "open": 4}
+	tests := map[string]string{
+		"medeival manuscrpts": "medieval manuscripts",
+		"open manuscripts":    "",
+		"opne":                "open",
+		"xyz":                 "",
+		"nanuscripts":         "",
+		"mansucriptsss":       "",
+	}
+	for query, expected := range tests {
+		if got := correctTerms(tokenize(query), vocabulary); got != expected {
+			t.Errorf("%s: expected %q, got %q", query, expected, got)
+		}
+	}
+}
+
+func TestParseSearchFields(t *testing.T) {
+	fields, err := ParseSearchFields("title^3, description^2.5,content")
+	if err != nil {
+		t.Fatalf("Error parsing search fields: %v", err)
+	}
+	expected := []string{"title^3", "description^2.5", "content"}
+	if len(fields) != len(expected) {
+		t.Fatalf("Expected %v, got %v", expected, fields)
+	}
+	for i := range expected {
+		if fields[i] != expected[i] {
+			t.Errorf("Expected %s, got %s", expected[i], fields[i])
+		}
+	}
+
+	for _, invalid := range []string{"", "title^", "title^x", "title,\"content\"", "^3"} {
+		_, err = ParseSearchFields(invalid)
+		if err == nil {
+			t.Errorf("Expected error for search fields %q, got nil", invalid)
+		}
+	}
+}
+
+func TestBuildQuerySearchFields(t *testing.T) {
+	var unmarshalledQuery queryData
+	query := buildQuery(types.SearchParams{Query: "searching"})
+	err := json.Unmarshal([]byte(query), &unmarshalledQuery)
+	if err != nil {
+		t.Fatalf("Error unmarshalling query: %v", err)
+	}
+	fields := unmarshalledQuery.Query.Bool.Must[0].(map[string]interface{})["multi_match"].(map[string]interface{})["fields"].([]interface{})
+	if len(fields) != len(DefaultSearchFields) {
+		t.Errorf("Expected default search fields %v, got %v", DefaultSearchFields, fields)
+	}
+
+	query = buildQuery(types.SearchParams{
+		Query:        "searching",
+		SearchFields: []string{"title^3", "content"},
+	})
+	unmarshalledQuery = queryData{}
+	err = json.Unmarshal([]byte(query), &unmarshalledQuery)
+	if err != nil {
+		t.Fatalf("Error unmarshalling query: %v", err)
+	}
+	fields = unmarshalledQuery.Query.Bool.Must[0].(map[string]interface{})["multi_match"].(map[string]interface{})["fields"].([]interface{})
+	if len(fields) != 2 || fields[0] != "title^3" || fields[1] != "content" {
+		t.Errorf("Expected [title^3 content], got %v", fields)
+	}
+}
+
+func TestParseFacets(t *testing.T) {
+	facets, err := ParseFacets("content_type,publication_year")
+	if err != nil {
+		t.Fatalf("Error parsing facets: %v", err)
+	}
+	if len(facets) != 2 || facets[0] != "content_type" || facets[1] != "publication_year" {
+		t.Errorf("Expected [content_type publication_year], got %v", facets)
+	}
+	_, err = ParseFacets("content_type,contnet_type")
+	if err == nil {
+		t.Errorf("Expected error for unknown facet, got nil")
+	}
+}
+
+func TestFilterFields(t *testing.T) {
+	fields := FilterFields()
+	for _, field := range []string{"content_type", "network_node", "contributors.username", "owner.username", "publication_date", "title.keyword"} {
+		if !slices.Contains(fields, field) {
+			t.Errorf("Expected %s to be filterable, got %v", field, fields)
+		}
+	}
+	for _, field := range []string{"_internal_id", "primary_url", "owner", "owner.url", "title", "title.prefix", "description", "content", "owner.name", "contributors.name", "visibility", "allowed_users"} {
+		if slices.Contains(fields, field) {
+			t.Errorf("Expected %s not to be filterable, got %v", field, fields)
+		}
+	}
+}
+
+func TestParseReturnFields(t *testing.T) {
+	fields, err := ParseReturnFields("title, owner,primary_url")
+	if err != nil {
+		t.Fatalf("Error parsing fields: %v", err)
+	}
+	if len(fields) != 3 || fields[1] != "owner" {
+		t.Errorf("Expected [title owner primary_url], got %v", fields)
+	}
+	for _, fieldList := range []string{"title,titel", "owner.name", "_internal_id", " , "} {
+		if _, err := ParseReturnFields(fieldList); err == nil {
+			t.Errorf("%s: expected error, got nil", fieldList)
+		}
+	}
+}
+
+func TestValidateSortField(t *testing.T) {
+	for _, field := range []string{"publication_date", "modified_date", "content_type", "title.keyword"} {
+		if err := ValidateSortField(field); err != nil {
+			t.Errorf("Expected %s to be sortable, got %v", field, err)
+		}
+	}
+	for _, field := range []string{"title", "primary_url", "visibility", "publication_dat"} {
+		if err := ValidateSortField(field); err == nil {
+			t.Errorf("Expected %s not to be sortable", field)
+		}
+	}
+}
+
+func TestParseDateBound(t *testing.T) {
+	now := time.Date(2024, 3, 14, 15, 9, 26, 0, time.UTC)
+	tests := []struct {
+		value    string
+		roundUp  bool
+		expected string
+	}{
+		{"2020", false, "2020-01-01T00:00:00Z"},
+		{"2020", true, "2020-12-31T23:59:59.999Z"},
+		{"2020-02", true, "2020-02-29T23:59:59.999Z"},
+		{"2020-02-10", true, "2020-02-10T23:59:59.999Z"},
+		{"2024-03-05T10:00:00+02:00", true, "2024-03-05T08:00:00Z"},
+		{"2024-03-05T10:00:00.5Z", false, "2024-03-05T10:00:00.5Z"},
+		{"now", false, "2024-03-14T15:09:26Z"},
+		{"now-7d", false, "2024-03-07T15:09:26Z"},
+		{"now+1h-30m", false, "2024-03-14T15:39:26Z"},
+		{"now-1M/M", false, "2024-02-01T00:00:00Z"},
+		{"now-1M/M", true, "2024-02-29T23:59:59.999Z"},
+		{"now/w", false, "2024-03-11T00:00:00Z"},
+		{"now/d", true, "2024-03-14T23:59:59.999Z"},
+	}
+	for _, tt := range tests {
+		bound, err := parseDateBound(tt.value, now, tt.roundUp)
+		if err != nil {
+			t.Errorf("%s: error parsing date: %v", tt.value, err)
+			continue
+		}
+		if bound.UTC().Format(time.RFC3339Nano) != tt.expected {
+			t.Errorf("%s: expected %s, got %s", tt.value, tt.expected, bound.UTC().Format(time.RFC3339Nano))
+		}
+	}
+	for _, value := range []string{"", "yesterday", "2020-13-01", "20", "now-7x", "now-7", "now-1234567d", "2024-03-05T10:00:00 02:00", "2024-03-05 10:00"} {
+		if err := ValidateDate(value); err == nil {
+			t.Errorf("%q: expected error, got nil", value)
+		}
+	}
+}
+
+func TestValidateDateField(t *testing.T) {
+	for _, field := range []string{"publication_date", "modified_date"} {
+		if err := ValidateDateField(field); err != nil {
+			t.Errorf("Expected %s to be a date field, got %v", field, err)
+		}
+	}
+	if err := ValidateDateField("title"); err == nil {
+		t.Error("Expected error for title, got nil")
+	}
+}
+
+func TestBuildQueryDateRange(t *testing.T) {
+	var unmarshalledQuery queryData
+	json.Unmarshal([]byte(buildQuery(types.SearchParams{StartDate: "2020-01-01", EndDate: "2020-12-31"})), &unmarshalledQuery)
+	filter, _ := json.Marshal(unmarshalledQuery.Query.Bool.Filter)
+	if string(filter) != `[{"range":{"publication_date":{"gte":"2020-01-01","lte":"2020-12-31"}}}]` {
+		t.Errorf("Expected publication date range, got %s", filter)
+	}
+
+	unmarshalledQuery = queryData{}
+	json.Unmarshal([]byte(buildQuery(types.SearchParams{StartDate: "now-7d", DateField: "modified_date"})), &unmarshalledQuery)
+	filter, _ = json.Marshal(unmarshalledQuery.Query.Bool.Filter)
+	if string(filter) != `[{"range":{"modified_date":{"gte":"now-7d"}}}]` {
+		t.Errorf("Expected modified date range, got %s", filter)
+	}
+}
+
+func TestBuildQueryRecency(t *testing.T) {
+	params := types.SearchParams{Query: "searching", ExactMatch: map[string][]string{"content_type": {"post"}}}
+	if query := buildQuery(params); strings.Contains(query, "function_score") {
+		t.Errorf("Expected no function score without a recency boost, got %s", query)
+	}
+
+	params.Recency = &types.RecencyBoost{Scale: "30d", Weight: 2}
+	var unmarshalledQuery queryData
+	json.Unmarshal([]byte(buildQuery(params)), &unmarshalledQuery)
+	if len(unmarshalledQuery.Query.Bool.Must) != 1 || len(unmarshalledQuery.Query.Bool.Filter) != 1 {
+		t.Fatalf("Expected one scored clause and the content type filter, got %+v", unmarshalledQuery.Query.Bool)
+	}
+	functionScore, _ := json.Marshal(unmarshalledQuery.Query.Bool.Must[0])
+	expected := `{"function_score":{"boost_mode":"multiply","functions":[{"weight":1},` +
+		`{"filter":{"exists":{"field":"publication_date"}},"gauss":{"publication_date":{"decay":0.5,"origin":"now","scale":"30d"}},"weight":2}],` +
+		`"query":{"multi_match":{"fields":["title^3","description^2","content","owner.name","contributors.name"],"fuzziness":"AUTO","query":"searching"}},` +
+		`"score_mode":"sum"}}`
+	if string(functionScore) != expected {
+		t.Errorf("Expected\n%s\ngot\n%s", expected, functionScore)
+	}
+
+	unmarshalledQuery = queryData{}
+	json.Unmarshal([]byte(buildQuery(types.SearchParams{Recency: params.Recency})), &unmarshalledQuery)
+	functionScore, _ = json.Marshal(unmarshalledQuery.Query.Bool.Must[0])
+	if !strings.Contains(string(functionScore), `"query":{"match_all":{}}`) {
+		t.Errorf("Expected recency boost of all documents, got %s", functionScore)
+	}
+}
+
+func TestRecencyBoost(t *testing.T) {
+	boost, err := RecencyBoost(types.Config{}, "")
+	if boost != nil || err != nil {
+		t.Errorf("Expected relevance ranking by default, got %+v, %v", boost, err)
+	}
+	boost, err = RecencyBoost(types.Config{}, RankRecent)
+	if err != nil || boost.Scale != DefaultRecencyScale || boost.Weight != DefaultRecencyWeight {
+		t.Errorf("Expected default recency boost, got %+v, %v", boost, err)
+	}
+	conf := types.Config{Rank: RankRecent, RecencyScale: "90d", RecencyWeight: 3}
+	boost, err = RecencyBoost(conf, "")
+	if err != nil || boost.Scale != "90d" || boost.Weight != 3 {
+		t.Errorf("Expected configured recency boost, got %+v, %v", boost, err)
+	}
+	if boost, _ := RecencyBoost(conf, RankRelevance); boost != nil {
+		t.Errorf("Expected relevance ranking to override configuration, got %+v", boost)
+	}
+	for _, conf := range []types.Config{
+		{Rank: "newest"},
+		{Rank: RankRecent, RecencyScale: "1y"},
+		{Rank: RankRecent, RecencyScale: "0d"},
+		{Rank: RankRecent, RecencyWeight: -1},
+	} {
+		if _, err := RecencyBoost(conf, ""); err == nil {
+			t.Errorf("%+v: expected error, got nil", conf)
+		}
+	}
+}
+
+func TestValidateRanking(t *testing.T) {
+	for _, conf := range []types.Config{
+		{},
+		{Rank: RankRecent, RecencyScale: "90d", RecencyWeight: 3},
+	} {
+		if err := ValidateRanking(conf); err != nil {
+			t.Errorf("%+v: expected no error, got %v", conf, err)
+		}
+	}
+	// Scales and weights are checked even when searches default to relevance,
+	// as any search may ask for rank=recent.
+	for _, conf := range []types.Config{
+		{Rank: "newest"},
+		{RecencyScale: "1y"},
+		{Rank: RankRelevance, RecencyWeight: -1},
+	} {
+		if err := ValidateRanking(conf); err == nil {
+			t.Errorf("%+v: expected error, got nil", conf)
+		}
+	}
+}
+
+func TestRecencyFactor(t *testing.T) {
+	now := time.Date(2024, 3, 14, 0, 0, 0, 0, time.UTC)
+	boost := &types.RecencyBoost{Scale: "365d", Weight: 1}
+	tests := map[string]float64{
+		"2024-03-14": 2,
+		"2023-03-15": 1.5,
+		"2012-01-01": 1,
+		"":           1,
+		"someday":    1,
+	}
+	for date, expected := range tests {
+		factor := recencyFactor(types.Document{PublicationDate: date}, boost, now)
+		if math.Abs(factor-expected) > 0.001 {
+			t.Errorf("%s: expected factor %g, got %g", date, expected, factor)
+		}
+	}
+}
+
+func TestParseSort(t *testing.T) {
+	keys, err := ParseSort("publication_date:desc, title.keyword,_score")
+	if err != nil {
+		t.Fatalf("Error parsing sort: %v", err)
+	}
+	expected := []types.SortKey{
+		{Field: "publication_date", Direction: "desc"},
+		{Field: "title.keyword", Direction: "asc"},
+		{Field: "_score", Direction: "desc"},
+	}
+	if !slices.Equal(keys, expected) {
+		t.Errorf("Expected %v, got %v", expected, keys)
+	}
+	for _, sortList := range []string{"title", "publication_date:up", "_id", "_score,_score:asc", " , ", "publication_date:desc:asc"} {
+		if _, err := ParseSort(sortList); err == nil {
+			t.Errorf("%q: expected error, got nil", sortList)
+		}
+	}
+}
+
+func TestBuildQuerySort(t *testing.T) {
+	var unmarshalledQuery queryData
+	json.Unmarshal([]byte(buildQuery(types.SearchParams{Query: "searching"})), &unmarshalledQuery)
+	if unmarshalledQuery.Sort != nil {
+		t.Errorf("Expected no sort by default, got %v", unmarshalledQuery.Sort)
+	}
+
+	sortKeys, _ := ParseSort("publication_date:desc,title.keyword:asc,_score")
+	unmarshalledQuery = queryData{}
+	json.Unmarshal([]byte(buildQuery(types.SearchParams{Query: "searching", Sort: sortKeys})), &unmarshalledQuery)
+	sortJSON, _ := json.Marshal(unmarshalledQuery.Sort)
+	expected := `[{"publication_date":"desc"},{"title.keyword":"asc"},{"_score":"desc"},{"_document_id":{"order":"asc","unmapped_type":"keyword"}}]`
+	if string(sortJSON) != expected {
+		t.Errorf("Expected sort %s, got %s", expected, sortJSON)
+	}
+}
+
+func TestBuildQueryFacets(t *testing.T) {
+	query := buildQuery(types.SearchParams{
+		Query:  "searching",
+		Facets: []string{"content_type", "publication_year"},
+	})
+	var unmarshalledQuery map[string]interface{}
+	err := json.Unmarshal([]byte(query), &unmarshalledQuery)
+	if err != nil {
+		t.Fatalf("Error unmarshalling query: %v", err)
+	}
+	aggs, ok := unmarshalledQuery["aggs"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("Expected aggs in query, got %s", query)
+	}
+	if _, ok := aggs["content_type"].(map[string]interface{})["terms"]; !ok {
+		t.Errorf("Expected terms aggregation for content_type, got %v", aggs["content_type"])
+	}
+	if _, ok := aggs["publication_year"].(map[string]interface{})["date_histogram"]; !ok {
+		t.Errorf("Expected date_histogram aggregation for publication_year, got %v", aggs["publication_year"])
+	}
+
+	query = buildQuery(types.SearchParams{Query: "searching"})
+	unmarshalledQuery = nil
+	err = json.Unmarshal([]byte(query), &unmarshalledQuery)
+	if err != nil {
+		t.Fatalf("Error unmarshalling query: %v", err)
+	}
+	if _, ok := unmarshalledQuery["aggs"]; ok {
+		t.Errorf("Expected no aggs in query without facets, got %s", query)
+	}
+}
+
+func TestSearchResultToFacets(t *testing.T) {
+	var searchResult types.SearchResult
+	err := json.Unmarshal([]byte(`{
+		"aggregations": {
+			"content_type": {"buckets": [{"key": "post", "doc_count": 120}, {"key": "group", "doc_count": 8}]},
+			"publication_year": {"buckets": [{"key": 1514764800000, "key_as_string": "2018", "doc_count": 3}]}
+		}
+	}`), &searchResult)
+	if err != nil {
+		t.Fatalf("Error unmarshalling search result: %v", err)
+	}
+	response := searchResultToResponse(&searchResult, types.SearchParams{})
+	if len(response.Facets["content_type"]) != 2 {
+		t.Fatalf("Expected 2 content_type buckets, got %v", response.Facets["content_type"])
+	}
+	if response.Facets["content_type"][0].Value != "post" || response.Facets["content_type"][0].Count != 120 {
+		t.Errorf("Expected post (120), got %v", response.Facets["content_type"][0])
+	}
+	if response.Facets["publication_year"][0].Value != "2018" {
+		t.Errorf("Expected 2018, got %v", response.Facets["publication_year"][0])
+	}
+}
+
+func TestBuildQueryHighlight(t *testing.T) {
+	query := buildQuery(types.SearchParams{Query: "searching"})
+	var unmarshalledQuery map[string]interface{}
+	err := json.Unmarshal([]byte(query), &unmarshalledQuery)
+	if err != nil {
+		t.Fatalf("Error unmarshalling query: %v", err)
+	}
+	if _, ok := unmarshalledQuery["highlight"]; ok {
+		t.Errorf("Expected no highlight without highlight param, got %s", query)
+	}
+
+	query = buildQuery(types.SearchParams{
+		Query:           "searching",
+		Highlight:       true,
+		HighlightFields: []string{"content"},
+		FragmentSize:    80,
+	})
+	unmarshalledQuery = nil
+	err = json.Unmarshal([]byte(query), &unmarshalledQuery)
+	if err != nil {
+		t.Fatalf("Error unmarshalling query: %v", err)
+	}
+	highlight, ok := unmarshalledQuery["highlight"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("Expected highlight in query, got %s", query)
+	}
+	if highlight["fragment_size"] != float64(80) {
+		t.Errorf("Expected fragment_size 80, got %v", highlight["fragment_size"])
+	}
+	fields := highlight["fields"].(map[string]interface{})
+	if _, ok := fields["content"]; !ok || len(fields) != 1 {
+		t.Errorf("Expected only content to be highlighted, got %v", fields)
+	}
+
+	_, err = ParseHighlightFields("title,owner")
+	if err == nil {
+		t.Errorf("Expected error for invalid highlight field, got nil")
+	}
+}
+
+func TestSearchResultHighlights(t *testing.T) {
+	var searchResult types.SearchResult
+	err := json.Unmarshal([]byte(`{
+		"hits": {
+			"total": {"value": 1},
+			"hits": [{
+				"_id": "abc",
+				"_source": {"title": "Searching Openly"},
+				"highlight": {"title": ["<em>Searching</em> Openly"]}
+			}]
+		}
+	}`), &searchResult)
+	if err != nil {
+		t.Fatalf("Error unmarshalling search result: %v", err)
+	}
+	response := searchResultToResponse(&searchResult, types.SearchParams{})
+	if len(response.Hits) != 1 {
+		t.Fatalf("Expected 1 hit, got %d", len(response.Hits))
+	}
+	if response.Hits[0].ID != "abc" {
+		t.Errorf("Expected ID abc, got %s", response.Hits[0].ID)
+	}
+	if response.Hits[0].Highlights["title"][0] != "<em>Searching</em> Openly" {
+		t.Errorf("Expected title highlight, got %v", response.Hits[0].Highlights)
+	}
+	responseJSON, _ := json.Marshal(response.Hits[0])
+	var hitFields map[string]interface{}
+	_ = json.Unmarshal(responseJSON, &hitFields)
+	if hitFields["title"] != "Searching Openly" || hitFields["highlights"] == nil {
+		t.Errorf("Expected highlights inline with document fields, got %s", responseJSON)
+	}
+}
+
+func TestBuildQueryCursor(t *testing.T) {
+	var unmarshalledQuery map[string]interface{}
+	query := buildQuery(types.SearchParams{
+		Query:  "searching",
+		Page:   3,
+		Cursor: CursorStart,
+	})
+	err := json.Unmarshal([]byte(query), &unmarshalledQuery)
+	if err != nil {
+		t.Fatalf("Error unmarshalling query: %v", err)
+	}
+	if _, ok := unmarshalledQuery["from"]; ok {
+		t.Errorf("Expected no from with cursor, got %s", query)
+	}
+	sort := unmarshalledQuery["sort"].([]interface{})
+	tieBreaker, _ := sort[1].(map[string]interface{})["_document_id"].(map[string]interface{})
+	if len(sort) != 2 || sort[0].(map[string]interface{})["_score"] != "desc" || tieBreaker["order"] != "asc" || tieBreaker["unmapped_type"] != "keyword" {
+		t.Errorf("Expected sort by _score then _document_id, got %v", sort)
+	}
+
+	unmarshalledQuery = nil
+	query = buildQuery(types.SearchParams{
+		Query:         "searching",
+		Sort:          []types.SortKey{{Field: "publication_date", Direction: "desc"}},
+		Cursor:        "abc",
+		SearchAfter:   []json.RawMessage{json.RawMessage(`1514764800000`), json.RawMessage(`"xyz"`)},
+		PointInTimeID: "pit123",
+	})
+	err = json.Unmarshal([]byte(query), &unmarshalledQuery)
+	if err != nil {
+		t.Fatalf("Error unmarshalling query: %v", err)
+	}
+	sort = unmarshalledQuery["sort"].([]interface{})
+	if len(sort) != 2 || sort[0].(map[string]interface{})["publication_date"] != "desc" || sort[1].(map[string]interface{})["_shard_doc"] != "asc" {
+		t.Errorf("Expected sort by publication_date then _shard_doc with a point in time, got %v", sort)
+	}
+	searchAfter := unmarshalledQuery["search_after"].([]interface{})
+	if len(searchAfter) != 2 || searchAfter[1] != "xyz" {
+		t.Errorf("Expected search_after [1514764800000 xyz], got %v", searchAfter)
+	}
+	if unmarshalledQuery["pit"].(map[string]interface{})["id"] != "pit123" {
+		t.Errorf("Expected pit id pit123, got %v", unmarshalledQuery["pit"])
+	}
+}
+
+func TestCursorRoundTrip(t *testing.T) {
+	var searchResult types.SearchResult
+	err := json.Unmarshal([]byte(`{
+		"hits": {
+			"total": {"value": 10},
+			"hits": [
+				{"_id": "a", "_source": {"title": "One"}, "sort": [1514764800000, "a"]},
+				{"_id": "b", "_source": {"title": "Two"}, "sort": [1514764800000, "b"]}
+			]
+		}
+	}`), &searchResult)
+	if err != nil {
+		t.Fatalf("Error unmarshalling search result: %v", err)
+	}
+	params := types.SearchParams{
+		Sort:   []types.SortKey{{Field: "publication_date", Direction: "desc"}},
+		Cursor: CursorStart,
+	}
+	token := nextCursor(context.Background(), types.Searcher{}, &searchResult, params, 2)
+	if token == "" {
+		t.Fatalf("Expected cursor for full page, got empty string")
+	}
+	if nextCursor(context.Background(), types.Searcher{}, &searchResult, params, 5) != "" {
+		t.Errorf("Expected no cursor for last page")
+	}
+
+	resumed := types.SearchParams{Cursor: token}
+	err = applyCursor(context.Background(), types.Searcher{}, &resumed)
+	if err != nil {
+		t.Fatalf("Error applying cursor: %v", err)
+	}
+	if len(resumed.Sort) != 1 || resumed.Sort[0].Field != "publication_date" || resumed.Sort[0].Direction != "desc" {
+		t.Errorf("Expected cursor sort publication_date desc, got %v", resumed.Sort)
+	}
+	if len(resumed.SearchAfter) != 2 || string(resumed.SearchAfter[0]) != "1514764800000" || string(resumed.SearchAfter[1]) != `"b"` {
+		t.Errorf("Expected search_after of last hit, got %s", resumed.SearchAfter)
+	}
+
+	mismatched := types.SearchParams{Cursor: token, Sort: []types.SortKey{{Field: "title.keyword", Direction: "asc"}}}
+	err = applyCursor(context.Background(), types.Searcher{}, &mismatched)
+	if !errors.Is(err, ErrInvalidCursor) {
+		t.Errorf("Expected ErrInvalidCursor for different sort, got %v", err)
+	}
+	for _, sort := range []string{`"s":[{"f":"content","d":"asc"}]`, `"s":[{"f":"_id","d":"asc"}]`, `"s":[{"f":"title.keyword","d":"up"}]`} {
+		tampered := types.SearchParams{Cursor: base64.RawURLEncoding.EncodeToString([]byte(`{"a":[1514764800000,"b"],` + sort + `}`))}
+		err = applyCursor(context.Background(), types.Searcher{}, &tampered)
+		if !errors.Is(err, ErrInvalidCursor) {
+			t.Errorf("Expected ErrInvalidCursor for cursor sort %s, got %v", sort, err)
+		}
+	}
+	invalid := types.SearchParams{Cursor: "not a cursor"}
+	err = applyCursor(context.Background(), types.Searcher{}, &invalid)
+	if !errors.Is(err, ErrInvalidCursor) {
+		t.Errorf("Expected ErrInvalidCursor for malformed cursor, got %v", err)
+	}
+}
+
+func TestDocumentID(t *testing.T) {
+	id := DocumentID("hc", "post/123")
+	if id == "" {
+		t.Fatalf("Expected non-empty ID, got empty")
+	}
+	if id != DocumentID("hc", "post/123") {
+		t.Errorf("Expected the same ID for the same node and internal ID")
+	}
+	if id == DocumentID("mla", "post/123") {
+		t.Errorf("Expected different IDs for different nodes")
+	}
+	if DocumentID("hc", "1") == DocumentID("hc1", "") {
+		t.Errorf("Expected node and internal ID boundaries to be preserved")
+	}
+	if len(newDocumentID()) != 20 || newDocumentID() == newDocumentID() {
+		t.Errorf("Expected distinct 20 character IDs for new documents")
+	}
+}
+
+func TestBulkResponseToResults(t *testing.T) {
+	documents := []types.Document{
+		{InternalID: "1", Title: "First"},
+		{InternalID: "2", Title: "Second"},
+		{InternalID: "3", Title: "Third"},
+	}
+	responseBody := strings.NewReader(`{
+		"errors": true,
+		"items": [
+			{"create": {"_id": "a", "status": 201}},
+			{"create": {"status": 400, "error": {"type": "mapper_parsing_exception", "reason": "failed to parse field [publication_date]"}}},
+			{"create": {"_id": "c", "status": 201}}
+		]
+	}`)
+	results, err := bulkResponseToResults(responseBody, documents)
+	if err != nil {
+		t.Fatalf("Error converting bulk response: %v", err)
+	}
+	if len(results) != 3 {
+		t.Fatalf("Expected 3 results, got %d", len(results))
+	}
+	for i, result := range results {
+		if result.Index != i || result.InternalID != documents[i].InternalID {
+			t.Errorf("Expected result %d for document %s, got %d for %s", i, documents[i].InternalID, result.Index, result.InternalID)
+		}
+	}
+	if !results[0].Succeeded() || results[0].ID != "a" {
+		t.Errorf("Expected first document indexed as a, got %+v", results[0])
+	}
+	if results[1].Succeeded() || results[1].Status != 400 || results[1].ID != "" {
+		t.Errorf("Expected second document to fail with 400, got %+v", results[1])
+	}
+	if results[1].Error != "mapper_parsing_exception: failed to parse field [publication_date]" {
+		t.Errorf("Expected mapper_parsing_exception error, got %s", results[1].Error)
+	}
+
+	_, err = bulkResponseToResults(strings.NewReader(`{"items": []}`), documents)
+	if err == nil {
+		t.Errorf("Expected error for mismatched item count, got nil")
+	}
+}
+
+func TestBulkRequestBody(t *testing.T) {
+	body, err := bulkRequestBody("test", []bulkAction{
+		{Action: "create", ID: "n", Document: types.Document{Title: "New"}},
+		{Action: "update", ID: "a", Document: types.Document{ID: "a", Title: "Updated"}},
+		{Action: "update", ID: "d", Document: types.Document{ID: "d", Description: "Revised"}},
+		{Action: "index", ID: "b", Document: types.Document{Title: "Upserted"}},
+		{Action: "delete", ID: "c", Document: types.Document{ID: "c"}},
+	})
+	if err != nil {
+		t.Fatalf("Error building bulk request body: %v", err)
+	}
+	expected := strings.Join([]string{
+		`{"create":{"_index":"test","_id":"n"}}`,
+		`{"_document_id":"n","owner":{},"title":"New"}`,
+		`{"update":{"_index":"test","_id":"a"}}`,
+		`{"doc":{"title":"Updated"}}`,
+		`{"update":{"_index":"test","_id":"d"}}`,
+		`{"doc":{"description":"Revised"}}`,
+		`{"index":{"_index":"test","_id":"b"}}`,
+		`{"_document_id":"b","owner":{},"title":"Upserted"}`,
+		`{"delete":{"_index":"test","_id":"c"}}`,
+	}, "\n") + "\n"
+	if body != expected {
+		t.Errorf("Expected body:\n%s\ngot:\n%s", expected, body)
+	}
+}
+
+func TestIndexMappingDrift(t *testing.T) {
+	var liveIndex map[string]interface{}
+	err := json.Unmarshal(indexSettings, &liveIndex)
+	if err != nil {
+		t.Fatalf("Error unmarshalling index settings: %v", err)
+	}
+	drift, err := IndexMappingDrift(map[string]interface{}{"test-1": liveIndex})
+	if err != nil {
+		t.Fatalf("Error comparing mappings: %v", err)
+	}
+	if !drift["test-1"].InSync {
+		t.Errorf("Expected embedded settings to be in sync with themselves, got %+v", drift["test-1"])
+	}
+
+	properties := liveIndex["mappings"].(map[string]interface{})["properties"].(map[string]interface{})
+	delete(properties, "language")
+	properties["content_type"] = map[string]interface{}{"type": "text"}
+	properties["author"] = map[string]interface{}{"type": "text", "fields": map[string]interface{}{"keyword": map[string]interface{}{"type": "keyword"}}}
+	delete(properties["owner"].(map[string]interface{})["properties"].(map[string]interface{})["url"].(map[string]interface{}), "index")
+	drift, err = IndexMappingDrift(map[string]interface{}{"test-1": liveIndex})
+	if err != nil {
+		t.Fatalf("Error comparing mappings: %v", err)
+	}
+	indexDrift := drift["test-1"]
+	if indexDrift.InSync {
+		t.Errorf("Expected drift, got in sync")
+	}
+	if strings.Join(indexDrift.Added, ",") != "author,author.keyword" {
+		t.Errorf("Expected added [author author.keyword], got %v", indexDrift.Added)
+	}
+	if strings.Join(indexDrift.Missing, ",") != "language" {
+		t.Errorf("Expected missing [language], got %v", indexDrift.Missing)
+	}
+	if len(indexDrift.Changed) != 2 {
+		t.Fatalf("Expected 2 changed fields, got %+v", indexDrift.Changed)
+	}
+	if indexDrift.Changed[0].Field != "content_type" || indexDrift.Changed[0].Expected != "type=keyword" || indexDrift.Changed[0].Actual != "type=text" {
+		t.Errorf("Expected content_type changed from keyword to text, got %+v", indexDrift.Changed[0])
+	}
+	if indexDrift.Changed[1].Field != "owner.url" || indexDrift.Changed[1].Expected != "type=keyword index=false" {
+		t.Errorf("Expected owner.url index changed, got %+v", indexDrift.Changed[1])
+	}
+}
@@ -0,0 +1,99 @@
+package search
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/MESH-Research/commons-connect/cc-search/types"
+)
+
+// scoreField sorts by relevance, as when no sort is given.
+const scoreField = "_score"
+
+// Directions of sort keys.
+const (
+	sortAscending  = "asc"
+	sortDescending = "desc"
+)
+
+// NewSortKey returns the sort key for field and direction. Fields sort
+// ascending and _score descending when direction is empty.
+func NewSortKey(field string, direction string) (types.SortKey, error) {
+	if field != scoreField {
+		if err := ValidateSortField(field); err != nil {
+			return types.SortKey{}, err
+		}
+	}
+	switch direction {
+	case ``:
+		direction = sortAscending
+		if field == scoreField {
+			direction = sortDescending
+		}
+	case sortAscending, sortDescending:
+	default:
+		return types.SortKey{}, fmt.Errorf(`invalid sort direction: %s (valid directions: asc, desc)`, direction)
+	}
+	return types.SortKey{Field: field, Direction: direction}, nil
+}
+
+// ParseSort parses a comma-separated list of sort keys, each a field with an
+// optional :asc or :desc, eg. `publication_date:desc,title.keyword,_score`.
+func ParseSort(sortList string) ([]types.SortKey, error) {
+	keys := []types.SortKey{}
+	for _, item := range strings.Split(sortList, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		field, direction, _ := strings.Cut(item, ":")
+		key, err := NewSortKey(field, direction)
+		if err != nil {
+			return nil, err
+		}
+		for _, previous := range keys {
+			if previous.Field == key.Field {
+				return nil, fmt.Errorf(`duplicate sort field: %s`, key.Field)
+			}
+		}
+		keys = append(keys, key)
+	}
+	if len(keys) == 0 {
+		return nil, errors.New(`no sort fields provided`)
+	}
+	return keys, nil
+}
+
+// fieldSort is the long form of a sort clause, for options beyond the order.
+type fieldSort struct {
+	Order string `json:"order"`
+	// Sorts indices that do not map the field as if it were of this type
+	// and missing from every document, rather than failing.
+	UnmappedType string `json:"unmapped_type,omitempty"`
+}
+
+// sortClauses returns the sort of a search ordered by keys. Results sorted
+// explicitly or walked with a cursor end with a tie-breaker, so that every hit
+// has a unique position and pages neither repeat nor skip hits. pointInTime
+// is whether the search is against a point in time.
+func sortClauses(keys []types.SortKey, cursor bool, pointInTime bool) []map[string]interface{} {
+	if len(keys) == 0 && !cursor {
+		return nil
+	}
+	if len(keys) == 0 {
+		keys = []types.SortKey{{Field: scoreField, Direction: sortDescending}}
+	}
+	clauses := make([]map[string]interface{}, 0, len(keys)+1)
+	for _, key := range keys {
+		clauses = append(clauses, map[string]interface{}{key.Field: key.Direction})
+	}
+	if pointInTime {
+		return append(clauses, map[string]interface{}{pointInTimeTieBreakerField: sortAscending})
+	}
+	// Indices created before the ID was copied into documents do not map
+	// the copy until the service next starts or the index is rebuilt.
+	return append(clauses, map[string]interface{}{
+		tieBreakerField: fieldSort{Order: sortAscending, UnmappedType: `keyword`},
+	})
+}
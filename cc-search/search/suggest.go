@@ -0,0 +1,196 @@
+package search
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/MESH-Research/commons-connect/cc-search/types"
+)
+
+// Fields that spelling suggestions are drawn from.
+var suggestFields = []string{"title", "description"}
+
+// Maximum number of suggestions returned.
+const suggestSize = 3
+
+// DefaultSuggestThreshold is the number of hits below which suggestions are
+// returned without being requested.
+const DefaultSuggestThreshold = 3
+
+type phraseSuggester struct {
+	Phrase struct {
+		Field           string            `json:"field"`
+		Size            int               `json:"size"`
+		DirectGenerator []directGenerator `json:"direct_generator"`
+		Collate         *suggestCollate   `json:"collate,omitempty"`
+	} `json:"phrase"`
+}
+
+type directGenerator struct {
+	Field       string `json:"field"`
+	SuggestMode string `json:"suggest_mode"`
+}
+
+// suggestCollate drops suggestions that would not match any document the
+// viewer may see, so that suggestions never reveal the words of hidden
+// documents.
+type suggestCollate struct {
+	Query struct {
+		Source interface{} `json:"source"`
+	} `json:"query"`
+	Prune bool `json:"prune"`
+}
+
+// Whether a search with params asks OpenSearch for suggestions along with its
+// hits. Searches that only want suggestions when they find few hits ask for
+// them afterwards, with a suggest request of their own.
+func suggestionsEnabled(params types.SearchParams) bool {
+	return params.Query != "" && params.Suggest
+}
+
+// Whether suggestions are returned for a search with params and total hits.
+func suggestionsWanted(params types.SearchParams, total int64) bool {
+	return params.Query != "" && (params.Suggest || total < int64(params.SuggestThreshold))
+}
+
+func newPhraseSuggester(field string, viewer *types.Viewer) phraseSuggester {
+	suggester := phraseSuggester{}
+	suggester.Phrase.Field = field
+	suggester.Phrase.Size = suggestSize
+	suggester.Phrase.DirectGenerator = []directGenerator{{Field: field, SuggestMode: "popular"}}
+	collate := &suggestCollate{}
+	// {{suggestion}} is filled in by OpenSearch with each candidate.
+	collateQuery := queryData{}
+	collateQuery.Query.Bool.Must = []interface{}{
+		map[string]interface{}{"match": map[string]string{field: "{{suggestion}}"}},
+	}
+	if viewer != nil {
+		collateQuery.Query.Bool.Filter = []interface{}{visibilityQuery(viewer)}
+	}
+	collate.Query.Source = collateQuery.Query
+	suggester.Phrase.Collate = collate
+	return suggester
+}
+
+// suggestQuery is the body of a request for suggestions alone.
+type suggestQuery struct {
+	Size    int                    `json:"size"`
+	Suggest map[string]interface{} `json:"suggest"`
+}
+
+// buildSuggest returns the suggest section of a search for params.
+func buildSuggest(params types.SearchParams) map[string]interface{} {
+	if !suggestionsEnabled(params) {
+		return nil
+	}
+	return suggestSection(params)
+}
+
+// suggestSection returns phrase suggesters for params.Query on each of the
+// suggest fields.
+func suggestSection(params types.SearchParams) map[string]interface{} {
+	suggest := map[string]interface{}{"text": params.Query}
+	for _, field := range suggestFields {
+		suggest[field] = newPhraseSuggester(field, params.Viewer)
+	}
+	return suggest
+}
+
+// searchResultToSuggestions merges the suggestions for each field, best
+// first.
+func searchResultToSuggestions(searchResult *types.SearchResult) []string {
+	scores := map[string]float64{}
+	for _, entries := range searchResult.Suggest {
+		for _, entry := range entries {
+			for _, option := range entry.Options {
+				if option.Score > scores[option.Text] {
+					scores[option.Text] = option.Score
+				}
+			}
+		}
+	}
+	return bestSuggestions(scores)
+}
+
+func bestSuggestions(scores map[string]float64) []string {
+	suggestions := make([]string, 0, len(scores))
+	for suggestion := range scores {
+		suggestions = append(suggestions, suggestion)
+	}
+	sort.Slice(suggestions, func(i, j int) bool {
+		if scores[suggestions[i]] != scores[suggestions[j]] {
+			return scores[suggestions[i]] > scores[suggestions[j]]
+		}
+		return suggestions[i] < suggestions[j]
+	})
+	if len(suggestions) > suggestSize {
+		suggestions = suggestions[:suggestSize]
+	}
+	return suggestions
+}
+
+// editDistance returns the Levenshtein distance between a and b.
+func editDistance(a string, b string) int {
+	ar, br := []rune(a), []rune(b)
+	previous := make([]int, len(br)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(ar); i++ {
+		current := make([]int, len(br)+1)
+		current[0] = i
+		for j := 1; j <= len(br); j++ {
+			cost := 1
+			if ar[i-1] == br[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous = current
+	}
+	return previous[len(br)]
+}
+
+// Terms shorter than this are not corrected, and corrections are at most
+// this many edits away, as with the OpenSearch direct generator's defaults.
+const (
+	minCorrectedLength = 4
+	maxCorrectionEdits = 2
+)
+
+// correctTerms replaces each term missing from vocabulary with the most
+// frequent vocabulary term within maxCorrectionEdits that starts with the same
+// letter. It returns an empty string if no term was replaced.
+func correctTerms(terms []string, vocabulary map[string]int) string {
+	corrected := make([]string, len(terms))
+	changed := false
+	for i, term := range terms {
+		corrected[i] = term
+		if vocabulary[term] > 0 || len([]rune(term)) < minCorrectedLength {
+			continue
+		}
+		best, bestDistance, bestFrequency := ``, maxCorrectionEdits+1, 0
+		for candidate, frequency := range vocabulary {
+			if []rune(candidate)[0] != []rune(term)[0] {
+				continue
+			}
+			distance := editDistance(term, candidate)
+			if distance > maxCorrectionEdits {
+				continue
+			}
+			if distance < bestDistance ||
+				(distance == bestDistance && frequency > bestFrequency) ||
+				(distance == bestDistance && frequency == bestFrequency && candidate < best) {
+				best, bestDistance, bestFrequency = candidate, distance, frequency
+			}
+		}
+		if best != `` {
+			corrected[i] = best
+			changed = true
+		}
+	}
+	if !changed {
+		return ``
+	}
+	return strings.Join(corrected, ` `)
+}
@@ -0,0 +1,15 @@
+package types
+
+// BulkItemResult is the outcome for a single document in a bulk request. The
+// document's fields are serialized inline with the result fields.
+type BulkItemResult struct {
+	Index  int    `json:"index"`
+	Status int    `json:"status"`
+	Error  string `json:"error,omitempty"`
+	Document
+}
+
+// Whether the document was successfully indexed.
+func (result BulkItemResult) Succeeded() bool {
+	return result.Status >= 200 && result.Status < 300
+}
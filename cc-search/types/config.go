@@ -1,5 +1,7 @@
 package types
 
+import "time"
+
 type Config struct {
 	User           string `mapstructure:"os_user"`
 	Password       string `mapstructure:"os_password"`
@@ -7,5 +9,47 @@ type Config struct {
 	IndexName      string `mapstructure:"os_index"`
 	APIKey         string `mapstructure:"api_key"`
 	AdminAPIKey    string `mapstructure:"admin_api_key"`
+	APIKeysFile    string `mapstructure:"api_keys_file"` // JSON registry of scoped API keys
+	ViewerSecret   string `mapstructure:"viewer_secret"` // Verifies signed viewer contexts
 	ClientMode     string `mapstructure:"os_client_mode"`
+	SearchFields   string `mapstructure:"search_fields"`
+	Backend        string `mapstructure:"backend"` // opensearch (default) or memory
+
+	// Used by the aws and aws-role client modes. Credentials not set here are
+	// taken from the standard AWS environment variables, shared config files
+	// or the instance/task role.
+	AWSRegion          string `mapstructure:"os_aws_region"`
+	AWSService         string `mapstructure:"os_aws_service"`
+	AWSAccessKeyID     string `mapstructure:"os_aws_access_key_id"`
+	AWSSecretAccessKey string `mapstructure:"os_aws_secret_access_key"`
+	AWSSessionToken    string `mapstructure:"os_aws_session_token"`
+	AWSRoleARN         string `mapstructure:"os_aws_role_arn"`
+
+	// Transport settings for connections to OpenSearch, used by every client
+	// mode. Files are PEM encoded. Timeouts use Go duration syntax, eg. "30s".
+	TLSCAFile             string        `mapstructure:"os_tls_ca_file"`
+	TLSCertFile           string        `mapstructure:"os_tls_cert_file"`
+	TLSKeyFile            string        `mapstructure:"os_tls_key_file"`
+	TLSMinVersion         string        `mapstructure:"os_tls_min_version"`
+	TLSInsecureSkipVerify bool          `mapstructure:"os_tls_insecure_skip_verify"`
+	DialTimeout           time.Duration `mapstructure:"os_dial_timeout"`
+	ResponseTimeout       time.Duration `mapstructure:"os_response_timeout"`
+
+	// Time allowed for requests to each group of API endpoints before they
+	// fail with 504 Gateway Timeout.
+	SearchTimeout   time.Duration `mapstructure:"search_timeout"`
+	DocumentTimeout time.Duration `mapstructure:"document_timeout"`
+	BulkTimeout     time.Duration `mapstructure:"bulk_timeout"`
+	IndexTimeout    time.Duration `mapstructure:"index_timeout"`
+
+	// Searches with fewer hits include spelling suggestions without them
+	// being requested. Unset uses the default; negative disables this.
+	SuggestThreshold int `mapstructure:"suggest_threshold"`
+
+	// Ranking of searches that don't request one: relevance (default) or
+	// recent, which boosts recently published documents. The boost decays to
+	// half of RecencyWeight at RecencyScale, eg. "365d".
+	Rank          string  `mapstructure:"rank"`
+	RecencyScale  string  `mapstructure:"recency_scale"`
+	RecencyWeight float64 `mapstructure:"recency_weight"`
 }
@@ -22,6 +22,16 @@ type Document struct {
 	Language        string   `json:"language,omitempty"`
 	ContentType     string   `json:"content_type,omitempty"`
 	NetworkNode     string   `json:"network_node,omitempty"`
+	Visibility      string   `json:"visibility,omitempty"`
+	AllowedGroups   []string `json:"allowed_groups,omitempty"`
+	AllowedUsers    []string `json:"allowed_users,omitempty"`
+}
+
+// Clears the lists of groups and users allowed to view the document, so that
+// they are not shown to readers.
+func (document *Document) HideAccessControl() {
+	document.AllowedGroups = nil
+	document.AllowedUsers = nil
 }
 
 // Filter out unnecessary fields from the document for the response. Fields to
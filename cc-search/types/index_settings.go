@@ -8,15 +8,31 @@ type OSIndexSettings struct {
 		} `json:"index,omitempty"`
 	} `json:"settings,omitempty"`
 	Mappings *struct {
-		Properties map[string]struct {
-			Type   string `json:"type,omitempty"`
-			Store  bool   `json:"store,omitempty"`
-			Index  bool   `json:"index,omitempty"`
-			Fields *struct {
-				Prefix *struct {
-					Type string `json:"type,omitempty"`
-				} `json:"prefix,omitempty"`
-			} `json:"fields,omitempty"`
-		} `json:"properties"`
+		Properties map[string]OSFieldMapping `json:"properties"`
 	} `json:"mappings,omitempty"`
 }
+
+// OSFieldMapping is the mapping of a single field. Object fields have
+// Properties, and multi-fields such as title.prefix are listed in Fields.
+type OSFieldMapping struct {
+	Type       string                    `json:"type,omitempty"`
+	Store      bool                      `json:"store,omitempty"`
+	Index      *bool                     `json:"index,omitempty"`
+	Fields     map[string]OSFieldMapping `json:"fields,omitempty"`
+	Properties map[string]OSFieldMapping `json:"properties,omitempty"`
+}
+
+// MappingDrift lists the differences between the index settings built into
+// the service and those of a live index.
+type MappingDrift struct {
+	InSync  bool            `json:"in_sync"`
+	Added   []string        `json:"added"`   // Fields in the live index but not the built-in settings
+	Missing []string        `json:"missing"` // Fields in the built-in settings but not the live index
+	Changed []MappingChange `json:"changed"` // Fields or settings whose definitions differ
+}
+
+type MappingChange struct {
+	Field    string `json:"field"`
+	Expected string `json:"expected"`
+	Actual   string `json:"actual"`
+}
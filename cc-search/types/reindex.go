@@ -0,0 +1,8 @@
+package types
+
+// ReindexResult describes the outcome of rebuilding the search index.
+type ReindexResult struct {
+	PreviousIndices []string `json:"previous_indices"`
+	NewIndex        string   `json:"new_index"`
+	Documents       int64    `json:"documents"`
+}
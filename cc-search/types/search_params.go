@@ -1,15 +1,58 @@
 package types
 
+import "encoding/json"
+
 type SearchParams struct {
-	Query         string
-	ExactMatch    map[string]string
-	ReturnFields  []string
-	SearchFields  []string
-	StartDate     string
-	EndDate       string
-	SortDirection string
-	SortField     string
-	Page          int
-	PerPage       int
-	RequestID     string
+	Query string
+	// ExactMatch restricts results to documents whose field has any of the
+	// values; ExcludeMatch to documents whose field has none of them.
+	ExactMatch      map[string][]string
+	ExcludeMatch    map[string][]string
+	ReturnFields    []string
+	SearchFields    []string
+	Facets          []string
+	Highlight       bool
+	HighlightFields []string
+	FragmentSize    int
+	StartDate       string
+	EndDate         string
+	Page            int
+	PerPage         int
+	RequestID       string
+	Cursor          string
+	PointInTime     bool
+	SearchAfter     []json.RawMessage
+	PointInTimeID   string
+	// Sort orders results by each key in turn, or by relevance if it is
+	// empty.
+	Sort []SortKey
+	// DateField is the field bounded by StartDate and EndDate, or
+	// publication_date if empty. The bounds may be dates, RFC 3339
+	// timestamps or date math such as now-7d.
+	DateField string
+	// Suggest requests spelling suggestions. They are also returned when a
+	// search has fewer than SuggestThreshold hits.
+	Suggest          bool
+	SuggestThreshold int
+	// Recency boosts the scores of recently published documents. Results are
+	// ranked by relevance alone if it is nil.
+	Recency *RecencyBoost
+	// Viewer restricts results to the documents the viewer may see. A nil
+	// viewer sees every document.
+	Viewer *Viewer
+}
+
+// RecencyBoost multiplies the score of each dated document by one plus
+// Weight, decaying to half of Weight for documents published Scale ago. Scale
+// uses OpenSearch time units, eg. 365d.
+type RecencyBoost struct {
+	Scale  string
+	Weight float64
+}
+
+// SortKey is a field to sort results by, or _score for relevance, and its
+// direction, asc or desc.
+type SortKey struct {
+	Field     string `json:"f"`
+	Direction string `json:"d"`
 }
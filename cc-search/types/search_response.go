@@ -1,9 +1,27 @@
 package types
 
 type SearchResponse struct {
-	Total     int64      `json:"total"`
-	Page      int        `json:"page"`
-	PerPage   int        `json:"per_page"`
-	RequestID string     `json:"request_id"`
-	Hits      []Document `json:"hits"`
+	Total     int64                    `json:"total"`
+	Page      int                      `json:"page"`
+	PerPage   int                      `json:"per_page"`
+	RequestID string                   `json:"request_id"`
+	Hits      []SearchHit              `json:"hits"`
+	Facets    map[string][]FacetBucket `json:"facets,omitempty"`
+	Cursor    string                   `json:"cursor,omitempty"`
+	// Spelling corrections of the query, best first.
+	Suggestions []string `json:"suggestions,omitempty"`
+}
+
+// SearchHit is a document returned by a search. Its fields are serialized
+// inline with the document's own fields.
+type SearchHit struct {
+	Document
+	Highlights map[string][]string `json:"highlights,omitempty"`
+}
+
+// FacetBucket is a single value of a facet along with the number of matching
+// documents that have that value.
+type FacetBucket struct {
+	Value string `json:"value"`
+	Count int64  `json:"count"`
 }
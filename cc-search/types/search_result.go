@@ -1,9 +1,12 @@
 package types
 
+import "encoding/json"
+
 // SearchResult is the struct that represents the response from an Elasticsearch search
 type SearchResult struct {
-	Took     int64 `json:"took"`
-	TimedOut bool  `json:"timed_out"`
+	Took     int64  `json:"took"`
+	PitID    string `json:"pit_id"`
+	TimedOut bool   `json:"timed_out"`
 	Shards   struct {
 		Total      int64 `json:"total"`
 		Successful int64 `json:"successful"`
@@ -17,10 +20,26 @@ type SearchResult struct {
 		} `json:"total"`
 		MaxScore float64 `json:"max_score"`
 		Hits     []struct {
-			Index  string   `json:"_index"`
-			ID     string   `json:"_id"`
-			Score  float64  `json:"_score"`
-			Source Document `json:"_source"`
+			Index     string              `json:"_index"`
+			ID        string              `json:"_id"`
+			Score     float64             `json:"_score"`
+			Source    Document            `json:"_source"`
+			Highlight map[string][]string `json:"highlight"`
+			Sort      []json.RawMessage   `json:"sort"`
 		} `json:"hits"`
 	} `json:"hits"`
+	Aggregations map[string]struct {
+		Buckets []struct {
+			Key         interface{} `json:"key"`
+			KeyAsString string      `json:"key_as_string"`
+			DocCount    int64       `json:"doc_count"`
+		} `json:"buckets"`
+	} `json:"aggregations"`
+	Suggest map[string][]struct {
+		Text    string `json:"text"`
+		Options []struct {
+			Text  string  `json:"text"`
+			Score float64 `json:"score"`
+		} `json:"options"`
+	} `json:"suggest"`
 }
@@ -0,0 +1,39 @@
+package types
+
+import "slices"
+
+// Document visibilities. Documents without a visibility are public. Any other
+// value is treated as private.
+const (
+	VisibilityPublic  = "public"  // Visible to everyone
+	VisibilityMembers = "members" // Visible to any logged-in viewer
+	VisibilityPrivate = "private" // Visible to the owner, allowed users and members of allowed groups
+)
+
+// Viewer is the logged-in user a request is made on behalf of. A viewer
+// without a username is anonymous and sees only public documents.
+type Viewer struct {
+	Username string   `json:"username,omitempty"`
+	Groups   []string `json:"groups,omitempty"`
+}
+
+// Whether the viewer may see document. A nil viewer may see every document.
+func (viewer *Viewer) CanView(document Document) bool {
+	if viewer == nil || document.Visibility == `` || document.Visibility == VisibilityPublic {
+		return true
+	}
+	if viewer.Username == `` {
+		return false
+	}
+	if document.Visibility == VisibilityMembers ||
+		document.Owner.Username == viewer.Username ||
+		slices.Contains(document.AllowedUsers, viewer.Username) {
+		return true
+	}
+	for _, group := range viewer.Groups {
+		if slices.Contains(document.AllowedGroups, group) {
+			return true
+		}
+	}
+	return false
+}